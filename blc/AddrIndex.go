@@ -0,0 +1,224 @@
+package blc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+)
+
+//地址索引：记录最长链上每个地址收到的所有输出以及花费这些输出的交易，任何地址（不只是钱包中的地址）的余额、UTXO和交易历史
+//都可以直接从索引中读取，所需时间只与该地址的交易数量有关，不需要遍历UTXO池或区块链
+//地址索引是可选的，在配置文件中设置addrindex = true时启用，启用前已有的区块需要用reindex命令建立索引
+
+//地址索引所在的数据库表，key为Base58Check格式的地址，value为该地址按区块高度排列的输出
+const addrIndexTableName = "addrindex"
+
+//输出所属地址的数据库表，连接区块时用于找出输入所花费的输出属于哪个地址，key为交易哈希加上8字节大端序的输出序号
+const addrIndexOutPointTableName = "addrindexOutpoints"
+
+//地址收到的一个输出
+type addrIndexEntry struct {
+	//输出所在的交易和区块高度
+	TxHash []byte
+	Height int64
+	Vout   int64
+	Output *TxOutput
+	//花费该输出的交易和区块高度，未花费时为nil
+	SpentTxHash []byte
+	SpentHeight int64
+}
+
+//地址交易历史中的一个交易
+type addressTx struct {
+	TxHash []byte
+	Height int64
+	//交易中该地址收到的金额
+	Received float64
+	//交易中该地址被花费的金额
+	Spent float64
+}
+
+//输出在数据库中的key
+func outPointKey(txHash []byte, vout int64) []byte {
+	return append(append([]byte{}, txHash...), IntToBytes(vout)...)
+}
+
+//读取地址索引中地址的所有输出
+func (tx *StoreTx) addrIndexEntries(address string) ([]*addrIndexEntry, error) {
+	var entries []*addrIndexEntry
+	entriesBytes := tx.backend.get(addrIndexTableName, []byte(address))
+	if entriesBytes == nil {
+		return entries, nil
+	}
+	err := json.Unmarshal(entriesBytes, &entries)
+	return entries, err
+}
+
+//保存地址的所有输出，没有输出时删除该地址
+func (tx *StoreTx) putAddrIndexEntries(address string, entries []*addrIndexEntry) error {
+	if len(entries) == 0 {
+		return tx.backend.delete(addrIndexTableName, []byte(address))
+	}
+	entriesBytes, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return tx.backend.put(addrIndexTableName, []byte(address), entriesBytes)
+}
+
+//修改地址索引中输入所花费的输出，输出不属于任何地址（例如coinbase交易的输入）时不做处理
+func (tx *StoreTx) updateSpentAddrIndexEntry(input *TxInput, update func(entry *addrIndexEntry)) error {
+	address := string(tx.backend.get(addrIndexOutPointTableName, outPointKey(input.TXHash, input.Vout)))
+	if address == "" {
+		return nil
+	}
+	entries, err := tx.addrIndexEntries(address)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if bytes.Equal(entry.TxHash, input.TXHash) && entry.Vout == input.Vout {
+			update(entry)
+		}
+	}
+	return tx.putAddrIndexEntries(address, entries)
+}
+
+//将区块中的交易加入地址索引，同一个区块中后面的交易可以花费前面的交易的输出
+func (tx *StoreTx) connectAddrIndex(b *Block) error {
+	for _, blockTx := range b.Txs {
+		if !blockTx.isCoinbase() {
+			for _, input := range blockTx.TxInputs {
+				err := tx.updateSpentAddrIndexEntry(input, func(entry *addrIndexEntry) {
+					entry.SpentTxHash = blockTx.TxHash
+					entry.SpentHeight = b.Height
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for i, output := range blockTx.TxOutputs {
+			//数据输出没有地址
+			address := output.address()
+			if address == "" {
+				continue
+			}
+			entries, err := tx.addrIndexEntries(address)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, &addrIndexEntry{TxHash: blockTx.TxHash, Height: b.Height, Vout: int64(i), Output: output})
+			err = tx.putAddrIndexEntries(address, entries)
+			if err != nil {
+				return err
+			}
+			err = tx.backend.put(addrIndexOutPointTableName, outPointKey(blockTx.TxHash, int64(i)), []byte(address))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//从地址索引中删除区块中的交易，按与连接时相反的顺序处理
+func (tx *StoreTx) disconnectAddrIndex(b *Block) error {
+	for i := len(b.Txs) - 1; i >= 0; i-- {
+		blockTx := b.Txs[i]
+		for vout, output := range blockTx.TxOutputs {
+			address := output.address()
+			if address == "" {
+				continue
+			}
+			entries, err := tx.addrIndexEntries(address)
+			if err != nil {
+				return err
+			}
+			kept := entries[:0]
+			for _, entry := range entries {
+				if !bytes.Equal(entry.TxHash, blockTx.TxHash) || entry.Vout != int64(vout) {
+					kept = append(kept, entry)
+				}
+			}
+			err = tx.putAddrIndexEntries(address, kept)
+			if err != nil {
+				return err
+			}
+			err = tx.backend.delete(addrIndexOutPointTableName, outPointKey(blockTx.TxHash, int64(vout)))
+			if err != nil {
+				return err
+			}
+		}
+		if !blockTx.isCoinbase() {
+			for _, input := range blockTx.TxInputs {
+				err := tx.updateSpentAddrIndexEntry(input, func(entry *addrIndexEntry) {
+					if bytes.Equal(entry.SpentTxHash, blockTx.TxHash) {
+						entry.SpentTxHash = nil
+						entry.SpentHeight = 0
+					}
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//从地址索引中读取地址的所有输出，地址索引未启用或未建立时ok为false
+func (bc *blockChain) addrIndexEntries(address string) (entries []*addrIndexEntry, ok bool) {
+	if !cfg.AddrIndex {
+		return nil, false
+	}
+	err := bc.Store.View(func(tx *StoreTx) error {
+		ok = tx.indexReady(addrIndexTableName)
+		if !ok {
+			return nil
+		}
+		var err error
+		entries, err = tx.addrIndexEntries(canonicalAddress(address))
+		return err
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return entries, ok
+}
+
+//地址的交易历史，包括收款和付款，按区块高度从低到高排列，需要启用并建立地址索引
+func (bc *blockChain) GetAddressHistory(address string) ([]*addressTx, error) {
+	entries, ok := bc.addrIndexEntries(address)
+	if !ok {
+		return nil, errors.New("地址索引未启用或未建立，请在配置文件中设置addrindex = true并运行reindex命令")
+	}
+	txs := make(map[string]*addressTx)
+	historyTx := func(txHash []byte, height int64) *addressTx {
+		key := hex.EncodeToString(txHash)
+		if txs[key] == nil {
+			txs[key] = &addressTx{TxHash: txHash, Height: height}
+		}
+		return txs[key]
+	}
+	for _, entry := range entries {
+		historyTx(entry.TxHash, entry.Height).Received += entry.Output.Value
+		if entry.SpentTxHash != nil {
+			historyTx(entry.SpentTxHash, entry.SpentHeight).Spent += entry.Output.Value
+		}
+	}
+	var history []*addressTx
+	for _, tx := range txs {
+		history = append(history, tx)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].Height != history[j].Height {
+			return history[i].Height < history[j].Height
+		}
+		return bytes.Compare(history[i].TxHash, history[j].TxHash) < 0
+	})
+	return history, nil
+}
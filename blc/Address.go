@@ -0,0 +1,152 @@
+package blc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+//地址：由版本号和数据组成，可以编码为Base58Check格式或Bech32格式
+//公钥哈希地址和P2SH地址的数据为20字节的哈希值，多重签名地址的数据为锁定脚本
+
+//地址解析失败的原因，可以用errors.Is判断
+var (
+	//含有不在字符表中的字符，或Bech32地址混用大小写
+	ErrAddressChar = errors.New("含有无效字符")
+	//地址或其中数据的长度错误
+	ErrAddressLength = errors.New("长度无效")
+	//校验码错误，通常是地址输入错误
+	ErrAddressChecksum = errors.New("校验码错误")
+	//未知的版本号、Bech32地址类型或前缀
+	ErrAddressVersion = errors.New("版本号无效")
+)
+
+//地址解析错误
+type AddressError struct {
+	//解析失败的地址
+	Address string
+	//失败的原因，为ErrAddressChar、ErrAddressLength、ErrAddressChecksum或ErrAddressVersion
+	Err error
+	//详细说明，例如出错字符的位置
+	Detail string
+}
+
+func (e *AddressError) Error() string {
+	msg := "地址" + e.Address + "无效：" + e.Err.Error()
+	if e.Detail != "" {
+		msg += "，" + e.Detail
+	}
+	return msg
+}
+
+func (e *AddressError) Unwrap() error {
+	return e.Err
+}
+
+//生成地址解析错误，地址由ParseAddress填写
+func newAddressError(err error, format string, args ...interface{}) *AddressError {
+	return &AddressError{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
+//解析后的地址
+type Address struct {
+	//Base58Check地址的版本号，Bech32地址为对应的Base58Check地址的版本号
+	Version byte
+	//公钥哈希、脚本哈希或多重签名的锁定脚本
+	Payload []byte
+}
+
+//解析Base58Check地址或Bech32地址，地址无效时返回*AddressError
+func ParseAddress(address string) (Address, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		if e, ok := err.(*AddressError); ok {
+			e.Address = address
+		}
+		return Address{}, err
+	}
+	return addr, nil
+}
+
+func parseAddress(address string) (Address, error) {
+	if address == "" {
+		return Address{}, newAddressError(ErrAddressLength, "地址为空")
+	}
+	if isBech32Address(address) {
+		return decodeBech32Address(address)
+	}
+	//第一步：将地址由字符串转为字节数组，并进行base58解码得到一个25字节的字节数组
+	decoded, err := Base58Decode([]byte(address))
+	if err != nil {
+		return Address{}, newAddressError(ErrAddressChar, err.Error())
+	}
+	if len(decoded) <= 1+addressChecksumLen {
+		return Address{}, newAddressError(ErrAddressLength, "解码后只有%d字节", len(decoded))
+	}
+	//第二步：取出版本号、数据和最后四个字节的校验码
+	version := decoded[0]
+	payload := decoded[1 : len(decoded)-addressChecksumLen]
+	actualChecksum := decoded[len(decoded)-addressChecksumLen:]
+	//第三步：对版本号和数据进行checksum算法，与地址中的校验码相等则认为地址没有输入错误
+	if !bytes.Equal(actualChecksum, checksum(decoded[:len(decoded)-addressChecksumLen])) {
+		return Address{}, newAddressError(ErrAddressChecksum, "请检查地址是否输入错误")
+	}
+	//第四步：校验版本号，公钥哈希地址和P2SH地址中都是20字节的哈希值
+	addr := Address{Version: version, Payload: payload}
+	switch {
+	case version == activeNetParams.MultisigAddrID:
+		if _, _, err := parseMultisigScript(payload); err != nil {
+			return Address{}, newAddressError(ErrAddressLength, "多重签名脚本无效：%v", err)
+		}
+	case version == activeNetParams.ScriptHashAddrID || addr.isPubKeyHash():
+		if len(payload) != 20 {
+			return Address{}, newAddressError(ErrAddressLength, "哈希值的长度为%d字节，应为20字节", len(payload))
+		}
+	default:
+		return Address{}, newAddressError(ErrAddressVersion, "未知的版本号0x%02x", version)
+	}
+	return addr, nil
+}
+
+//是否为公钥哈希地址
+func (addr Address) isPubKeyHash() bool {
+	_, ok := schemeByAddressVersion(addr.Version)
+	return ok
+}
+
+//返回地址的Base58Check格式，钱包和账本中的地址都以这种格式保存
+func (addr Address) String() string {
+	return string(encodeAddress(addr.Version, addr.Payload))
+}
+
+//返回地址的Bech32格式，多重签名地址不支持Bech32格式
+func (addr Address) Bech32() (string, error) {
+	return encodeBech32Address(addr.Version, addr.Payload)
+}
+
+//校验地址的有效性，Base58Check地址和Bech32地址都可以
+func ValidateAddress(address string) bool {
+	_, err := ParseAddress(address)
+	return err == nil
+}
+
+//将地址转换为Base58Check格式，无效的地址原样返回
+func canonicalAddress(address string) string {
+	if !isBech32Address(address) {
+		return address
+	}
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return addr.String()
+}
+
+//将地址转换为Bech32格式
+func Bech32Address(address string) (string, error) {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return addr.Bech32()
+}
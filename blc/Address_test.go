@@ -0,0 +1,120 @@
+package blc
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+//将字符串中第i个字符替换为c
+func replaceAddressChar(address string, i int, c byte) string {
+	b := []byte(address)
+	b[i] = c
+	return string(b)
+}
+
+func TestParseAddress(t *testing.T) {
+	wallet := newTestWallet(t, 1, KeyTypeP256)
+	address := string(wallet.GetAddress())
+	hash := HashPubKey(wallet.PublicKey)
+	bech32Address, err := Address{activeNetParams.PubKeyHashAddrID, hash}.Bech32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//主网的Bech32地址前缀不同
+	if err := SelectNetwork(mainNetParams.Name); err != nil {
+		t.Fatal(err)
+	}
+	mainNetBech32, err := Address{activeNetParams.PubKeyHashAddrID, hash}.Bech32()
+	SelectNetwork(regTestParams.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//校验码错误：改变最后一个字符
+	lastChar, bech32LastChar := byte('2'), byte('q')
+	if address[len(address)-1] == lastChar {
+		lastChar = '3'
+	}
+	if bech32Address[len(bech32Address)-1] == bech32LastChar {
+		bech32LastChar = 'p'
+	}
+	tests := []struct {
+		name    string
+		address string
+		err     error
+	}{
+		{"pubkey hash", address, nil},
+		{"bech32", bech32Address, nil},
+		{"script hash", ScriptHashAddress([]byte{OP_1}), nil},
+		{"empty", "", ErrAddressLength},
+		{"invalid char 0", replaceAddressChar(address, 5, '0'), ErrAddressChar},
+		{"invalid char l", replaceAddressChar(address, 5, 'l'), ErrAddressChar},
+		{"too short", "1111", ErrAddressLength},
+		{"short hash", string(encodeAddress(activeNetParams.PubKeyHashAddrID, hash[:19])), ErrAddressLength},
+		{"long hash", string(encodeAddress(activeNetParams.ScriptHashAddrID, append(hash, 0))), ErrAddressLength},
+		{"checksum", replaceAddressChar(address, len(address)-1, lastChar), ErrAddressChecksum},
+		{"unknown version", string(encodeAddress(0xff, hash)), ErrAddressVersion},
+		{"mainnet version", string(encodeAddress(mainNetParams.PubKeyHashAddrID, hash)), ErrAddressVersion},
+		{"bech32 mixed case", strings.ToUpper(bech32Address[:1]) + bech32Address[1:], ErrAddressChar},
+		{"bech32 checksum", replaceAddressChar(bech32Address, len(bech32Address)-1, bech32LastChar), ErrAddressChecksum},
+		{"bech32 mainnet prefix", mainNetBech32, ErrAddressVersion},
+	}
+	for _, test := range tests {
+		addr, err := ParseAddress(test.address)
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("%s：%v", test.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s：地址%s的错误为%v，应为%v", test.name, test.address, err, test.err)
+			continue
+		}
+		var addrErr *AddressError
+		if !errors.As(err, &addrErr) || addrErr.Address != test.address {
+			t.Errorf("%s：错误中没有记录地址", test.name)
+		}
+		if addr.Payload != nil {
+			t.Errorf("%s：解析失败时返回了地址", test.name)
+		}
+	}
+	if addr, _ := ParseAddress(bech32Address); addr.String() != address {
+		t.Errorf("Bech32地址%s对应的地址为%s，应为%s", bech32Address, addr.String(), address)
+	}
+}
+
+func FuzzBase58Decode(f *testing.F) {
+	for _, seed := range []string{"", "1", "11", "1112", "z", "3yQ", "0", "1l1", "111111111111111111114oLvT2"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		decoded, err := Base58Decode(input)
+		valid := true
+		for _, b := range input {
+			if bytes.IndexByte(b58Alphabet, b) < 0 {
+				valid = false
+				break
+			}
+		}
+		if err != nil {
+			if valid {
+				t.Fatalf("%q只含base58字符，解码失败：%v", input, err)
+			}
+			return
+		}
+		if !valid {
+			t.Fatalf("%q含有非base58字符，解码成功", input)
+		}
+		//base58编码是唯一的，重新编码后与输入一致
+		if encoded := Base58Encode(decoded); !bytes.Equal(encoded, input) {
+			t.Fatalf("%q解码后重新编码为%q", input, encoded)
+		}
+		//字节数组编码后可以解码为原来的字节数组
+		again, err := Base58Decode(Base58Encode(input))
+		if err != nil || !bytes.Equal(again, input) {
+			t.Fatalf("%x编码后解码为%x：%v", input, again, err)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package blc
 
 import (
 	"bytes"
+	"fmt"
 	"math/big"
 )
 
@@ -21,7 +22,8 @@ func Base58Encode(input []byte) []byte {
 		result = append(result, b58Alphabet[mod.Int64()])
 	}
 	ReverseBytes(result)
-	for b := range input {
+	//输入中每个前导的0x00字节都编码为一个字符表中的第一个字符
+	for _, b := range input {
 		if b == 0x00 {
 			result = append([]byte{b58Alphabet[0]}, result...)
 		} else {
@@ -31,24 +33,30 @@ func Base58Encode(input []byte) []byte {
 	return result
 }
 
-// Base58转字节数组，解码
-func Base58Decode(input []byte) []byte {
+// Base58转字节数组，解码，输入中含有不在字符表中的字符时返回错误
+func Base58Decode(input []byte) ([]byte, error) {
 	result := big.NewInt(0)
 	zeroBytes := 0
-	for b := range input {
-		if b == 0x00 {
+	//每个前导的字符表中的第一个字符都解码为一个0x00字节
+	for _, b := range input {
+		if b == b58Alphabet[0] {
 			zeroBytes++
+		} else {
+			break
 		}
 	}
 	payload := input[zeroBytes:]
-	for _, b := range payload {
+	for i, b := range payload {
 		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, fmt.Errorf("第%d个字符%q不是base58字符", zeroBytes+i+1, b)
+		}
 		result.Mul(result, big.NewInt(58))
 		result.Add(result, big.NewInt(int64(charIndex)))
 	}
 	decoded := result.Bytes()
 	decoded = append(bytes.Repeat([]byte{byte(0x00)}, zeroBytes), decoded...)
-	return decoded
+	return decoded, nil
 }
 
 // 字节数组反转
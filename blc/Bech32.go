@@ -0,0 +1,233 @@
+package blc
+
+import (
+	"errors"
+	"strings"
+)
+
+//Bech32地址（参照比特币的BIP173和BIP350）：人类可读前缀 + 分隔符"1" + base32数据 + 6个字符的校验码
+//数据的第一个字符为地址类型，其后为20字节的哈希值，地址类型为0时使用Bech32校验码，其他类型使用Bech32m校验码
+//Bech32地址不区分大小写，校验码可以检测出任意4个以内的字符错误，只有一个字符错误时还可以指出错误的位置
+//钱包中仍然以Base58Check地址作为key，Bech32地址在使用前转换为对应的Base58Check地址
+//多重签名地址中包含完整的锁定脚本，长度超过Bech32的限制，只能使用Base58Check编码
+
+//人类可读前缀与数据之间的分隔符
+const bech32Separator = '1'
+
+//Bech32地址的最大长度
+const bech32MaxLen = 90
+
+//校验码的字符数
+const bech32ChecksumLen = 6
+
+//Bech32和Bech32m校验码的常数
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+//base32字符表，不含1、b、i、o
+var bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+//Bech32地址类型对应的Base58Check地址版本号，下标为地址类型
+func bech32AddressVersions() []byte {
+	return []byte{activeNetParams.PubKeyHashAddrID, activeNetParams.ScriptHashAddrID, activeNetParams.Secp256k1AddrID, activeNetParams.SchnorrAddrID}
+}
+
+//计算BCH校验码的多项式余数
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+//将人类可读前缀展开为参与校验码计算的数据
+func bech32HRPExpand(hrp string) []byte {
+	result := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]>>5)
+	}
+	result = append(result, 0)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]&31)
+	}
+	return result
+}
+
+//计算数据的校验码
+func bech32CreateChecksum(hrp string, data []byte, constant uint32) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, bech32ChecksumLen)...)
+	mod := bech32Polymod(values) ^ constant
+	checksum := make([]byte, bech32ChecksumLen)
+	for i := range checksum {
+		checksum[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+//将数据（每个元素为5位）编码为Bech32字符串
+func bech32Encode(hrp string, data []byte, constant uint32) string {
+	combined := append(append([]byte{}, data...), bech32CreateChecksum(hrp, data, constant)...)
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte(bech32Separator)
+	for _, v := range combined {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String()
+}
+
+//解码Bech32字符串，返回人类可读前缀、数据（不含校验码）和校验码的常数
+//校验码错误时，如果只改动一个字符就可以通过校验，错误信息中给出该字符的位置和正确的字符
+func bech32Decode(str string) (string, []byte, uint32, error) {
+	if len(str) > bech32MaxLen {
+		return "", nil, 0, newAddressError(ErrAddressLength, "长度为%d，超过了最大长度%d", len(str), bech32MaxLen)
+	}
+	if strings.ToLower(str) != str && strings.ToUpper(str) != str {
+		return "", nil, 0, newAddressError(ErrAddressChar, "不能混用大小写字母")
+	}
+	lower := strings.ToLower(str)
+	pos := strings.LastIndexByte(lower, bech32Separator)
+	if pos < 1 || pos+bech32ChecksumLen+1 > len(lower) {
+		return "", nil, 0, newAddressError(ErrAddressLength, "缺少分隔符或校验码")
+	}
+	hrp := lower[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, newAddressError(ErrAddressChar, "第%d个字符无效", i+1)
+		}
+	}
+	data := make([]byte, 0, len(lower)-pos-1)
+	for i := pos + 1; i < len(lower); i++ {
+		v := strings.IndexByte(bech32Charset, lower[i])
+		if v < 0 {
+			return "", nil, 0, newAddressError(ErrAddressChar, "第%d个字符%q不是Bech32字符", i+1, str[i])
+		}
+		data = append(data, byte(v))
+	}
+	constant := bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, bech32ChecksumError(str, hrp, data, pos)
+	}
+	return hrp, data[:len(data)-bech32ChecksumLen], constant, nil
+}
+
+//校验码错误时尝试找出错误的位置：逐个替换数据部分的字符，只替换一个字符就能通过校验时给出提示
+func bech32ChecksumError(str, hrp string, data []byte, pos int) error {
+	values := append(bech32HRPExpand(hrp), data...)
+	offset := len(values) - len(data)
+	for i := range data {
+		original := values[offset+i]
+		for v := byte(0); v < 32; v++ {
+			if v == original {
+				continue
+			}
+			values[offset+i] = v
+			constant := bech32Polymod(values)
+			if constant == bech32Const || constant == bech32mConst {
+				correct := bech32Charset[v]
+				if strings.ToUpper(str) == str {
+					correct = strings.ToUpper(string(correct))[0]
+				}
+				return newAddressError(ErrAddressChecksum, "第%d个字符%q可能应为%q", pos+2+i, str[pos+1+i], correct)
+			}
+		}
+		values[offset+i] = original
+	}
+	return newAddressError(ErrAddressChecksum, "可能有多个字符输入错误")
+}
+
+//按位重新分组，例如将8位一组的字节转换为5位一组，pad为false时多余的位必须为0
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	var result []byte
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("数据超出了位数范围")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("填充位无效")
+	}
+	return result, nil
+}
+
+//将Base58Check地址的版本号和哈希值编码为Bech32地址，多重签名地址等不支持Bech32的地址返回错误
+func encodeBech32Address(version byte, payload []byte) (string, error) {
+	addressType := -1
+	for i, v := range bech32AddressVersions() {
+		if v == version {
+			addressType = i
+		}
+	}
+	if addressType < 0 || len(payload) != 20 {
+		return "", errors.New("该类型的地址不支持Bech32编码")
+	}
+	program, err := convertBits(payload, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	constant := uint32(bech32mConst)
+	if addressType == 0 {
+		constant = bech32Const
+	}
+	return bech32Encode(activeNetParams.Bech32HRP, append([]byte{byte(addressType)}, program...), constant), nil
+}
+
+//解码Bech32地址，返回的地址使用对应的Base58Check地址的版本号
+func decodeBech32Address(address string) (Address, error) {
+	hrp, data, constant, err := bech32Decode(address)
+	if err != nil {
+		return Address{}, err
+	}
+	if hrp != activeNetParams.Bech32HRP {
+		return Address{}, newAddressError(ErrAddressVersion, "前缀%s不是本链的地址前缀%s", hrp, activeNetParams.Bech32HRP)
+	}
+	if len(data) == 0 || int(data[0]) >= len(bech32AddressVersions()) {
+		return Address{}, newAddressError(ErrAddressVersion, "未知的地址类型")
+	}
+	//地址类型0使用Bech32校验码，其他类型使用Bech32m校验码
+	if (data[0] == 0) != (constant == bech32Const) {
+		return Address{}, newAddressError(ErrAddressChecksum, "地址类型与校验码的类型不匹配")
+	}
+	payload, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return Address{}, newAddressError(ErrAddressLength, err.Error())
+	}
+	if len(payload) != 20 {
+		return Address{}, newAddressError(ErrAddressLength, "哈希值的长度为%d字节，应为20字节", len(payload))
+	}
+	return Address{Version: bech32AddressVersions()[data[0]], Payload: payload}, nil
+}
+
+//判断地址是否为Bech32格式（以任一网络的前缀和分隔符开头，不区分大小写），其他网络的地址在解码时返回错误
+func isBech32Address(address string) bool {
+	for _, params := range chainParamsList {
+		if strings.HasPrefix(strings.ToLower(address), params.Bech32HRP+string(bech32Separator)) {
+			return true
+		}
+	}
+	return false
+}
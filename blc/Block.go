@@ -86,8 +86,20 @@ func NewBlock(height int64, prevBlockHash []byte, txs []*transaction) *Block {
 	return b
 }
 
-//创建创世块
-func NewGenesisBlock(txs []*transaction) *Block {
-	//创世块的上一个区块的哈希值为0
-	return NewBlock(0, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, txs)
+//创世区块coinbase交易中的数据
+const genesisMessage = "study-public-chain genesis block"
+
+//创建当前网络的创世块：时间戳由网络参数决定，coinbase交易中只有一个携带genesisMessage的数据输出，
+//没有任何人可以花费创世块中的币，因此同一个网络的所有节点创建的创世块完全相同
+func NewGenesisBlock() *Block {
+	txInput := &TxInput{TXHash: []byte{}, Vout: -1, PubKey: []byte{}, ScriptSig: []byte(genesisMessage)}
+	sb := &scriptBuilder{}
+	sb.addOp(OP_RETURN).addData([]byte(genesisMessage))
+	txOutput := &TxOutput{Value: 0, ScriptPubKey: sb.Script()}
+	coinbaseTx := &transaction{[]byte{}, []*TxInput{txInput}, []*TxOutput{txOutput}, 0}
+	coinbaseTx.TxHash = coinbaseTx.hashTransaction()
+	//创世块的上一个区块的哈希值由当前网络的参数决定，为0
+	b := &Block{0, activeNetParams.GenesisPrevBlockHash, []*transaction{coinbaseTx}, activeNetParams.GenesisTimestamp, nil, 0}
+	b.Hash, b.Nonce = NewProofOfWork(b).Run()
+	return b
 }
@@ -2,12 +2,9 @@ package blc
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"log"
 	"math/big"
 	"os"
@@ -27,8 +24,8 @@ const lastHashKey = "L"
 type blockChain struct {
 	//最新的区块的哈希值
 	Tip []byte
-	//bolt数据库对象，该数据库中存储了区块链中所有的区块
-	Db *bolt.DB
+	//区块链的存储，其中存储了区块链中所有的区块和UTXO池
+	Store ChainStore
 }
 
 //判断当前区块链的数据库是否存在
@@ -41,107 +38,138 @@ func dbExist(dbName string) bool {
 
 //创建区块链
 func CreateBlockChain(address, nodeId string) *blockChain {
-	dbName := fmt.Sprintf(dbName, nodeId)
+	dbName := dataFileName(dbName, nodeId)
 	//判断当前区块链的数据库是否存在
 	if dbExist(dbName) {
 		log.Fatal("当前区块链已存在，不能重复创建")
 	}
 	//打开或创建数据库
-	db, err := bolt.Open(dbName, 0600, nil)
+	store, err := OpenBoltStore(dbName)
 	if err != nil {
 		log.Panic(err)
 	}
-	//创世块的哈希值
+	return createBlockChainInStore(store, address)
+}
+
+//在存储中创建区块链：存入当前网络固定的创世块，再挖出第一个区块，第一个区块的挖矿奖励发给address
+func createBlockChainInStore(store ChainStore, address string) *blockChain {
+	genesisBlock := NewGenesisBlock()
+	if !bytes.Equal(genesisBlock.Hash, activeNetParams.GenesisHash) {
+		log.Panicf("创世块的哈希值%x与%s网络的创世块%x不一致", genesisBlock.Hash, activeNetParams.Name, activeNetParams.GenesisHash)
+	}
+	//第一个区块的哈希值
 	var hash []byte
-	err = db.Update(func(tx *bolt.Tx) error {
-		//创建数据库表
-		bucket, err := tx.CreateBucket([]byte(tableName))
+	err := store.Update(func(tx *StoreTx) error {
+		if tx.Tip() != nil {
+			return errors.New("当前区块链已存在，不能重复创建")
+		}
+		//将创世块存储到数据库中
+		err := tx.PutBlock(genesisBlock)
 		if err != nil {
 			return err
 		}
-		if bucket != nil {
-			//创建coinbase transaction
-			coinbaseTx := NewCoinbaseTransaction(address)
-			//创建创世块
-			genesisBlock := NewGenesisBlock([]*transaction{coinbaseTx})
-			hash = genesisBlock.Hash
-			//将创世块存储到数据库中
-			err := bucket.Put(hash, genesisBlock.Serialize())
-			if err != nil {
-				return err
-			}
-			err = bucket.Put([]byte(lastHashKey), hash)
-			if err != nil {
-				return err
-			}
-			return nil
+		err = tx.SetTip(genesisBlock)
+		if err != nil {
+			return err
+		}
+		//创世块中的币不能花费，创建区块链的地址获得第一个区块的挖矿奖励
+		firstBlock := NewBlock(1, genesisBlock.Hash, []*transaction{newCoinbaseTransactionWithFees(address, 1, 0)})
+		hash = firstBlock.Hash
+		err = tx.PutBlock(firstBlock)
+		if err != nil {
+			return err
 		}
-		return errors.New("数据库表创建失败")
+		return tx.SetTip(firstBlock)
 	})
 	if err != nil {
 		log.Panic(err)
 	}
-	//创建区块链类型，其中的最新的区块的哈希值为创世块的哈希值
-	bc := &blockChain{hash, db}
-	//重置UTXO池
-	utxoSet := UTXOSet{bc}
-	utxoSet.ResetUTXOSet()
-	//返回区块链类型
-	return bc
+	//创建区块链类型，其中的最新的区块的哈希值为第一个区块的哈希值，UTXO池已经由SetTip更新
+	return &blockChain{hash, store}
 }
 
 //从数据库中获取区块链
 func GetBlockChain(nodeId string) *blockChain {
-	dbName := fmt.Sprintf(dbName, nodeId)
+	dbName := dataFileName(dbName, nodeId)
 	if !dbExist(dbName) {
 		log.Fatal("当前区块链不存在，请先创建！")
 	}
-	db, err := bolt.Open(dbName, 0600, nil)
+	store, err := OpenBoltStore(dbName)
 	if err != nil {
 		log.Panic(err)
 	}
+	return getBlockChainFromStore(store)
+}
+
+//从存储中获取区块链
+func getBlockChainFromStore(store ChainStore) *blockChain {
 	var lastHash []byte
-	err = db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(tableName))
-		if bucket != nil {
-			lastHash = bucket.Get([]byte(lastHashKey))
-			return nil
+	err := store.View(func(tx *StoreTx) error {
+		lastHash = tx.Tip()
+		if lastHash == nil {
+			return errors.New("当前数据库表不存在，可能是因为区块链未创建")
 		}
-		return errors.New("当前数据库表不存在，可能是因为区块链未创建")
+		return nil
 	})
 	if err != nil {
 		log.Panic(err)
 	}
-	return &blockChain{lastHash, db}
+	bc := &blockChain{lastHash, store}
+	bc.ensureHeightIndex()
+	if err := bc.checkGenesisBlock(); err != nil {
+		log.Fatal(err)
+	}
+	return bc
+}
+
+//校验区块链的创世块是否为当前网络的创世块，避免打开其他网络或旧版本创建的区块链
+func (bc *blockChain) checkGenesisBlock() error {
+	var genesisHash []byte
+	err := bc.Store.View(func(tx *StoreTx) error {
+		genesisHash = tx.BlockHashByHeight(0)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(genesisHash, activeNetParams.GenesisHash) {
+		return fmt.Errorf("区块链的创世块%x不是%s网络的创世块%x，请确认--network参数，或删除数据文件后重新创建区块链", genesisHash, activeNetParams.Name, activeNetParams.GenesisHash)
+	}
+	return nil
+}
+
+//关闭区块链的存储
+func (bc *blockChain) Close() {
+	if err := bc.Store.Close(); err != nil {
+		log.Println(err)
+	}
 }
 
 //区块链迭代器结构
 type BlockChainIterator struct {
 	currHash []byte
-	db       *bolt.DB
+	store    ChainStore
 }
 
 //创建区块链迭代器
 func (bc *blockChain) Iterator() *BlockChainIterator {
-	bci := BlockChainIterator{currHash: bc.Tip, db: bc.Db}
+	bci := BlockChainIterator{currHash: bc.Tip, store: bc.Store}
 	return &bci
 }
 
 //迭代区块链，返回区块链中下一个区块，从第一个区块开始返回
 func (bci *BlockChainIterator) Next() *Block {
-	var blockBytes []byte
-	err := bci.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(tableName))
-		if bucket != nil {
-			blockBytes = bucket.Get(bci.currHash)
-			return nil
+	var b *Block
+	err := bci.store.View(func(tx *StoreTx) error {
+		b = tx.Block(bci.currHash)
+		if b == nil {
+			return fmt.Errorf("区块%x不存在，可能是因为区块链未创建", bci.currHash)
 		}
-		return errors.New("当前数据库表不存在，可能是因为区块链未创建")
+		return nil
 	})
 	if err != nil {
 		log.Panic(err)
 	}
-	b := Deserialize(blockBytes)
 	bci.currHash = b.PrevBlockHash
 	return b
 }
@@ -175,54 +203,63 @@ func (bc *blockChain) PrintChain() {
 	}
 }
 
-//向区块链中添加新的区块
-func (bc *blockChain) AddBlock(address, nodeId string, txs []*transaction) {
-	dbName := fmt.Sprintf(dbName, nodeId)
-	//判断当前区块链的数据库是否存在
-	exist := dbExist(dbName)
-	if !exist {
-		log.Println("当前区块链不存在，请先创建区块链")
-		os.Exit(1)
-	}
-	//在添加新区块之前对txs进行签名验证
+//向区块链中添加新的区块，交易的签名、手续费、锁定时间或数据输出无效时返回错误，区块链不变
+func (bc *blockChain) AddBlock(address string, txs []*transaction) error {
+	_, err := bc.mineBlock(address, txs)
+	return err
+}
+
+//验证交易并挖出包含这些交易的新区块，挖矿奖励发给address
+//区块、最新区块、UTXO池、钱包账本和各个索引在同一个事务中更新，任何一步失败时区块链不变
+func (bc *blockChain) mineBlock(address string, txs []*transaction) (*Block, error) {
+	//在添加新区块之前对txs进行签名验证，并校验交易的锁定时间
+	tip := bc.Tip
+	nextHeight := bc.GetBestHeight() + 1
+	var fees float64
 	for _, tx := range txs {
-		if !bc.VerifyTransaction(tx) {
-			log.Panic("签名验证失败")
+		if err := bc.VerifyTransaction(tx); err != nil {
+			return nil, err
+		}
+		fee, err := bc.transactionFee(tx)
+		if err != nil {
+			return nil, err
+		}
+		fees += fee
+		if err := bc.checkTransactionLocks(tx, nextHeight, tip); err != nil {
+			return nil, err
+		}
+		if err := tx.checkDataOutputs(MaxDataCarrierSize); err != nil {
+			return nil, err
 		}
 	}
-	//挖矿奖励
-	tx := NewCoinbaseTransaction(address)
-	txs = append(txs, tx)
+	//挖矿奖励，包括区块中所有交易的手续费
+	txs = append(txs, newCoinbaseTransactionWithFees(address, nextHeight, fees))
 	//向区块链中添加新的区块
-	err := bc.Db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(tableName))
-		if bucket != nil {
-			//获取区块链中最新的区块
-			blockBytes := bucket.Get(bc.Tip)
-			lastBlock := Deserialize(blockBytes)
-			//创建新的区块
-			b := NewBlock(lastBlock.Height+1, lastBlock.Hash, txs)
-			//将创建的新区块添加到数据库中
-			err := bucket.Put(b.Hash, b.Serialize())
-			if err != nil {
-				return err
-			}
-			err = bucket.Put([]byte(lastHashKey), b.Hash)
-			if err != nil {
-				return err
-			}
-			//更新区块链中最新的区块的哈希值
-			bc.Tip = b.Hash
-			return nil
+	var b *Block
+	err := bc.Store.Update(func(tx *StoreTx) error {
+		//获取区块链中最新的区块，交易是在该区块之上验证的
+		lastBlock := tx.Block(tx.Tip())
+		if lastBlock == nil {
+			return errors.New("当前数据库表不存在，可能是因为区块链未创建")
+		}
+		if !bytes.Equal(lastBlock.Hash, tip) {
+			return errors.New("验证交易期间最新的区块已经改变，请重试")
+		}
+		//创建新的区块
+		b = NewBlock(lastBlock.Height+1, lastBlock.Hash, txs)
+		//将创建的新区块添加到数据库中，SetTip同时更新UTXO池和索引
+		err := tx.PutBlock(b)
+		if err != nil {
+			return err
 		}
-		return errors.New("当前数据库表不存在，可能是因为区块链未创建")
+		return tx.SetTip(b)
 	})
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
-	//更新UTXO池
-	utxoSet := UTXOSet{bc}
-	utxoSet.UpdateUTXOSet(txs)
+	//更新区块链中最新的区块的哈希值
+	bc.Tip = b.Hash
+	return b, nil
 }
 
 //找出当前用户所有可用的UTXO所在的交易数组
@@ -262,7 +299,7 @@ func (bc *blockChain) AddBlock(address, nodeId string, txs []*transaction) {
 //}
 
 //找出适用于当前交易的UTXO
-func (bc *blockChain) findSuitableUTXOs(from string, amount float64) (map[string]int64, float64) {
+func (bc *blockChain) findSuitableUTXOs(from string, amount float64, outputs int, opts TxOptions) (*coinSelection, error) {
 	//	transactions := bc.findUTXOTransactions(from)
 	//	suitableUTXOs := make(map[string][]int64)
 	//	var total float64 = 0
@@ -281,18 +318,18 @@ func (bc *blockChain) findSuitableUTXOs(from string, amount float64) (map[string
 	//		}
 	//	}
 	//	return suitableUTXOs, total
-	suitableUTXOs := make(map[string]int64)
-	var total float64 = 0
-	utxoMap := bc.FindUTXOAndTxHashForAddress(from)
-	for txHashStr, utxo := range utxoMap {
-		if total < amount {
-			suitableUTXOs[txHashStr] = utxo.Vout
-			total += utxo.Output.Value
-		} else {
-			break
+	//找出地址的所有UTXO，再按照选币策略进行选择，outputs为不含找零的输出数量
+	var utxos []*addressUTXO
+	for txHashStr, txUTXOs := range bc.FindUTXOAndTxHashForAddress(from) {
+		txHash, err := hex.DecodeString(txHashStr)
+		if err != nil {
+			return nil, err
+		}
+		for _, utxo := range txUTXOs {
+			utxos = append(utxos, &addressUTXO{OutPoint{txHash, utxo.Vout}, utxo.Output})
 		}
 	}
-	return suitableUTXOs, total
+	return selectCoins(utxos, amount, outputs, opts)
 }
 
 func (bc *blockChain) GetBalance(address string) float64 {
@@ -314,8 +351,30 @@ func (bc *blockChain) GetBalance(address string) float64 {
 	return total
 }
 
+//计算交易的手续费，即输入总额减去输出总额，输出总额大于输入总额时返回错误
+func (bc *blockChain) transactionFee(tx *transaction) (float64, error) {
+	if tx.isCoinbase() {
+		return 0, nil
+	}
+	var inputTotal, outputTotal int64
+	for _, input := range tx.TxInputs {
+		prevOutput, err := bc.prevOutput(input)
+		if err != nil {
+			return 0, err
+		}
+		inputTotal += toCoinUnits(prevOutput.Value)
+	}
+	for _, output := range tx.TxOutputs {
+		outputTotal += toCoinUnits(output.Value)
+	}
+	if outputTotal > inputTotal {
+		return 0, fmt.Errorf("交易%x的输出总额大于输入总额", tx.TxHash)
+	}
+	return fromCoinUnits(inputTotal - outputTotal), nil
+}
+
 //对一个transaction中的所有input进行数字签名
-func (bc *blockChain) SignTransaction(tx *transaction, privateKey ecdsa.PrivateKey) {
+func (bc *blockChain) SignTransaction(tx *transaction, wallet *Wallet) {
 	//如果是coinbase交易，则不需要进行数字签名
 	if tx.isCoinbase() {
 		return
@@ -333,18 +392,46 @@ func (bc *blockChain) SignTransaction(tx *transaction, privateKey ecdsa.PrivateK
 		preTXs[hex.EncodeToString(preTX.TxHash)] = preTX
 	}
 	//进行数字签名
-	tx.Sign(privateKey, preTXs)
+	tx.Sign(wallet, preTXs)
 }
 
 //根据交易的哈希值找出当前交易
 func (bc *blockChain) FindTransaction(txHash []byte) (transaction, error) {
+	b, err := bc.findTransactionBlock(txHash)
+	if err != nil {
+		return transaction{}, err
+	}
+	for _, tx := range b.Txs {
+		if bytes.Compare(tx.TxHash, txHash) == 0 {
+			return *tx, nil
+		}
+	}
+	return transaction{}, errors.New("交易不存在")
+}
+
+//根据交易的哈希值找出交易所在的区块
+func (bc *blockChain) findTransactionBlock(txHash []byte) (*Block, error) {
+	return bc.findTransactionBlockFrom(txHash, bc.Tip)
+}
+
+//从哈希值为fromHash的区块开始向前查找交易所在的区块，校验不在最长链上的区块时只能在它之前的区块中查找
+func (bc *blockChain) findTransactionBlockFrom(txHash, fromHash []byte) (*Block, error) {
+	//从最新的区块开始查找时，启用并建立了交易索引则只在索引中查找，索引中没有的交易不在最长链上，不需要再遍历区块链
+	if bytes.Equal(fromHash, bc.Tip) {
+		if b, ok := bc.findIndexedTransactionBlock(txHash); ok {
+			if b == nil {
+				return nil, errors.New("交易不存在")
+			}
+			return b, nil
+		}
+	}
 	var hashInt big.Int
-	iterator := bc.Iterator()
+	iterator := &BlockChainIterator{currHash: fromHash, store: bc.Store}
 	for {
 		b := iterator.Next()
 		for _, tx := range b.Txs {
 			if bytes.Compare(tx.TxHash, txHash) == 0 {
-				return *tx, nil
+				return b, nil
 			}
 		}
 		hashInt.SetBytes(b.PrevBlockHash)
@@ -353,25 +440,59 @@ func (bc *blockChain) FindTransaction(txHash []byte) (transaction, error) {
 			break
 		}
 	}
-	return transaction{}, errors.New("交易不存在")
+	return nil, errors.New("交易不存在")
 }
 
-//验证交易的数字签名
-func (bc *blockChain) VerifyTransaction(tx *transaction) bool {
-	//交易的哈希值与交易的映射
-	preTXs := make(map[string]transaction)
-	//找到当前交易中的所有input所对应的交易
+//找出花费了某个输出的交易
+func (bc *blockChain) findSpendingTransaction(txHash []byte, vout int64) (*transaction, int, error) {
+	var hashInt big.Int
+	iterator := bc.Iterator()
+	for {
+		b := iterator.Next()
+		for _, tx := range b.Txs {
+			for i, input := range tx.TxInputs {
+				if bytes.Compare(input.TXHash, txHash) == 0 && input.Vout == vout {
+					return tx, i, nil
+				}
+			}
+		}
+		hashInt.SetBytes(b.PrevBlockHash)
+		//如果当前区块的前一个区块的哈希值为0，则认为当前区块已经是创世区块了，跳出循环
+		if hashInt.Cmp(big.NewInt(0)) == 0 {
+			break
+		}
+	}
+	return nil, 0, errors.New("该输出尚未被花费")
+}
+
+//验证交易的数字签名，所引用的输出不存在或签名错误时返回错误
+func (bc *blockChain) VerifyTransaction(tx *transaction) error {
+	//找到当前交易中的所有input所引用的输出
+	var prevOutputs []*TxOutput
 	for _, input := range tx.TxInputs {
-		//通过input中的交易的哈希找到所对应的交易
-		preTX, err := bc.FindTransaction(input.TXHash)
+		prevOutput, err := bc.prevOutput(input)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		//先将交易的哈希值由字节数组编码为字符串，然后将交易的哈希值（字符的形式）与交易进行映射
-		preTXs[hex.EncodeToString(preTX.TxHash)] = preTX
+		prevOutputs = append(prevOutputs, prevOutput)
 	}
 	//数字签名验证
-	return tx.Verify(preTXs)
+	if !tx.verifyWithOutputs(prevOutputs) {
+		return fmt.Errorf("交易%x的签名验证失败", tx.TxHash)
+	}
+	return nil
+}
+
+//找到输入所引用的输出，所引用的交易不存在或输出序号超出范围时返回错误
+func (bc *blockChain) prevOutput(input *TxInput) (*TxOutput, error) {
+	prevTx, err := bc.FindTransaction(input.TXHash)
+	if err != nil {
+		return nil, fmt.Errorf("输入所引用的交易%x不存在：%v", input.TXHash, err)
+	}
+	if input.Vout < 0 || input.Vout >= int64(len(prevTx.TxOutputs)) {
+		return nil, fmt.Errorf("交易%x中没有序号为%d的输出", input.TXHash, input.Vout)
+	}
+	return prevTx.TxOutputs[input.Vout], nil
 }
 
 //找出所有未花费的输出
@@ -392,8 +513,20 @@ func (bc *blockChain) FindUTXOs() map[string][]UTXO {
 				}
 			}
 			for index, output := range tx.TxOutputs {
+				//数据输出不可花费，不需要加入UTXO池
+				if output.isUnspendable() {
+					continue
+				}
 				txHashStr := hex.EncodeToString(tx.TxHash)
-				if _, isPresent := spentedOutputs[txHashStr]; !isPresent {
+				//同一个交易中的其他输出被花费时，当前输出仍然可能未被花费
+				spent := false
+				for _, vout := range spentedOutputs[txHashStr] {
+					if vout == int64(index) {
+						spent = true
+						break
+					}
+				}
+				if !spent {
 					utxo := UTXO{output, int64(index)}
 					utxos := unSpentedOutputs[txHashStr]
 					utxos = append(utxos, utxo)
@@ -413,23 +546,24 @@ func (bc *blockChain) FindUTXOs() map[string][]UTXO {
 //查找某个地址所对应的所有UTXO
 func (bc *blockChain) FindUTXOForAddress(address string) []UTXO {
 	var result []UTXO
-	err := bc.Db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(utxoTableName))
-		if bucket != nil {
-			//游标
-			c := bucket.Cursor()
-			for k, v := c.First(); k != nil; k, v = c.Next() {
-				var utxos []UTXO
-				json.Unmarshal(v, &utxos)
-				for _, utxo := range utxos {
-					if utxo.Output.UnLockScriptPubKeyWithAddress(address) {
-						result = append(result, utxo)
-					}
+	//启用地址索引时直接读取地址未花费的输出
+	if entries, ok := bc.addrIndexEntries(address); ok {
+		for _, entry := range entries {
+			if entry.SpentTxHash == nil && entry.Output.UnLockScriptPubKeyWithAddress(address) {
+				result = append(result, UTXO{entry.Output, entry.Vout})
+			}
+		}
+		return result
+	}
+	err := bc.Store.View(func(tx *StoreTx) error {
+		return tx.ForEachUTXOs(func(txHash []byte, utxos []UTXO) error {
+			for _, utxo := range utxos {
+				if utxo.Output.UnLockScriptPubKeyWithAddress(address) {
+					result = append(result, utxo)
 				}
 			}
 			return nil
-		}
-		return errors.New("UTXOSet数据不存在")
+		})
 	})
 	if err != nil {
 		log.Panic(err)
@@ -437,28 +571,29 @@ func (bc *blockChain) FindUTXOForAddress(address string) []UTXO {
 	return result
 }
 
-//查找某个地址所对应的所有UTXO及其对应的交易哈希
-func (bc *blockChain) FindUTXOAndTxHashForAddress(address string) map[string]UTXO {
-	result := make(map[string]UTXO)
-	err := bc.Db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(utxoTableName))
-		if bucket != nil {
-			//游标
-			c := bucket.Cursor()
-			for k, v := c.First(); k != nil; k, v = c.Next() {
-				var utxos []UTXO
-				json.Unmarshal(v, &utxos)
-				txHashStr := hex.EncodeToString(k)
-				for _, utxo := range utxos {
-					if utxo.Output.UnLockScriptPubKeyWithAddress(address) {
-						result[txHashStr] = utxo
-						break
-					}
+//查找某个地址所对应的所有UTXO，key为UTXO所在交易的哈希
+func (bc *blockChain) FindUTXOAndTxHashForAddress(address string) map[string][]UTXO {
+	result := make(map[string][]UTXO)
+	//启用地址索引时直接读取地址未花费的输出
+	if entries, ok := bc.addrIndexEntries(address); ok {
+		for _, entry := range entries {
+			if entry.SpentTxHash == nil && entry.Output.UnLockScriptPubKeyWithAddress(address) {
+				txHashStr := hex.EncodeToString(entry.TxHash)
+				result[txHashStr] = append(result[txHashStr], UTXO{entry.Output, entry.Vout})
+			}
+		}
+		return result
+	}
+	err := bc.Store.View(func(tx *StoreTx) error {
+		return tx.ForEachUTXOs(func(txHash []byte, utxos []UTXO) error {
+			txHashStr := hex.EncodeToString(txHash)
+			for _, utxo := range utxos {
+				if utxo.Output.UnLockScriptPubKeyWithAddress(address) {
+					result[txHashStr] = append(result[txHashStr], utxo)
 				}
 			}
 			return nil
-		}
-		return errors.New("UTXOSet数据不存在")
+		})
 	})
 	if err != nil {
 		log.Panic(err)
@@ -466,6 +601,47 @@ func (bc *blockChain) FindUTXOAndTxHashForAddress(address string) map[string]UTX
 	return result
 }
 
+//找出区块链中所有输出所锁定的公钥哈希，key为公钥哈希的十六进制字符串
+func (bc *blockChain) usedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+	var hashInt big.Int
+	iterator := bc.Iterator()
+	for {
+		b := iterator.Next()
+		for _, tx := range b.Txs {
+			for _, output := range tx.TxOutputs {
+				if output.Ripemd160Hash != nil {
+					used[hex.EncodeToString(output.Ripemd160Hash)] = true
+				}
+			}
+		}
+		hashInt.SetBytes(b.PrevBlockHash)
+		//如果当前区块的前一个区块的哈希值为0，则认为当前区块已经是创世区块了，跳出循环
+		if hashInt.Cmp(big.NewInt(0)) == 0 {
+			break
+		}
+	}
+	return used
+}
+
+//判断某个输出是否在UTXO池中
+func (bc *blockChain) isUnspent(txHash []byte, vout int64) bool {
+	unspent := false
+	err := bc.Store.View(func(tx *StoreTx) error {
+		for _, utxo := range tx.UTXOs(txHash) {
+			if utxo.Vout == vout {
+				unspent = true
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return unspent
+}
+
 //获取当前节点中最长的区块链高度
 func (bc *blockChain) GetBestHeight() int64 {
 	block := bc.Iterator().Next()
@@ -473,60 +649,71 @@ func (bc *blockChain) GetBestHeight() int64 {
 }
 
 //直接向区块链中添加区块
-func (bc *blockChain) AddBlockToBlockchain(b *Block) {
-	err := bc.Db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(tableName))
-		if b != nil {
-			block := bucket.Get(b.Hash)
-			// 如果当前区块已存在，不需要做任何过多的处理
-			if block != nil {
-				return nil
-			}
-			err := bucket.Put(b.Hash, b.Serialize())
+func (bc *blockChain) AddBlockToBlockchain(b *Block) error {
+	if b == nil {
+		return errors.New("区块不能为空")
+	}
+	//前一个区块不存在时无法校验锁定时间，也无法确定区块在区块链中的位置
+	if err := bc.checkPrevBlock(b); err != nil {
+		return err
+	}
+	//校验区块中交易的锁定时间和数据输出，数据输出使用共识规则中的限制，与本节点的datacarriersize无关
+	if err := bc.checkBlockLocks(b); err != nil {
+		return err
+	}
+	for _, tx := range b.Txs {
+		if err := tx.checkDataOutputs(MaxConsensusDataCarrierSize); err != nil {
+			return err
+		}
+	}
+	err := bc.Store.Update(func(tx *StoreTx) error {
+		// 如果当前区块已存在，不需要做任何过多的处理
+		if tx.BlockBytes(b.Hash) != nil {
+			return nil
+		}
+		err := tx.PutBlock(b)
+		if err != nil {
+			return err
+		}
+		//取出最新的区块
+		blockInDB := tx.Block(tx.Tip())
+		//如果最新的区块的高度小于当前区块的高度，则更新区块链中的最新的区块
+		if blockInDB.Height < b.Height {
+			err = tx.SetTip(b)
 			if err != nil {
 				return err
 			}
-			//取出最新的区块
-			blockHash := bucket.Get([]byte(lastHashKey))
-			blockBytes := bucket.Get(blockHash)
-			blockInDB := Deserialize(blockBytes)
-			//如果最新的区块的高度小于当前区块的高度，则更新区块链中的最新的区块
-			if blockInDB.Height < b.Height {
-				bucket.Put([]byte(lastHashKey), b.Hash)
-				bc.Tip = b.Hash
-			}
+			bc.Tip = b.Hash
 		}
 		return nil
 	})
-	if err != nil {
-		log.Panic(err)
-	}
+	//前一个区块不存在等错误由调用者处理，不影响已有的区块链
+	return err
 }
 
-//获取区块链中所有区块的哈希值
-func (bc *blockChain) GetBlockHashes() [][]byte {
-	blockIterator := bc.Iterator()
-	var blockHashs [][]byte
-	for {
-		block := blockIterator.Next()
-		blockHashs = append(blockHashs, block.Hash)
-		var hashInt big.Int
-		hashInt.SetBytes(block.PrevBlockHash)
-		if hashInt.Cmp(big.NewInt(0)) == 0 {
-			break
+//校验区块的前一个区块是否存在，创世区块没有前一个区块，必须是当前网络的创世块
+func (bc *blockChain) checkPrevBlock(b *Block) error {
+	if bytes.Equal(b.PrevBlockHash, activeNetParams.GenesisPrevBlockHash) {
+		if !bytes.Equal(b.Hash, activeNetParams.GenesisHash) {
+			return fmt.Errorf("区块%x不是%s网络的创世块", b.Hash, activeNetParams.Name)
 		}
+		return nil
 	}
-	return blockHashs
+	prevBlockBytes, err := bc.GetBlock(b.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	if prevBlockBytes == nil {
+		return fmt.Errorf("区块%x的前一个区块%x不存在", b.Hash, b.PrevBlockHash)
+	}
+	return nil
 }
 
 //根据区块哈希获取区块的字节数组
 func (bc *blockChain) GetBlock(blockHash []byte) ([]byte, error) {
 	var blockBytes []byte
-	err := bc.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(tableName))
-		if b != nil {
-			blockBytes = b.Get(blockHash)
-		}
+	err := bc.Store.View(func(tx *StoreTx) error {
+		blockBytes = tx.BlockBytes(blockHash)
 		return nil
 	})
 	return blockBytes, err
@@ -0,0 +1,72 @@
+package blc
+
+import (
+	"bytes"
+	"testing"
+)
+
+//前一个区块不存在的区块和空区块被拒绝，区块链不变
+func TestAddBlockWithUnknownParent(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	bc := newTestChain(t, miner)
+	orphan := NewBlock(1, []byte("unknown parent"), []*transaction{NewCoinbaseTransaction(string(miner.GetAddress()))})
+	if err := bc.AddBlockToBlockchain(orphan); err == nil {
+		t.Fatal("前一个区块不存在的区块被接受")
+	}
+	if err := bc.AddBlockToBlockchain(nil); err == nil {
+		t.Fatal("空区块被接受")
+	}
+	if height := bc.GetBestHeight(); height != 1 {
+		t.Fatalf("区块被拒绝后区块高度为%d，应为1", height)
+	}
+}
+
+//引用不存在的交易或超出范围的输出的交易不能被打包
+func TestMineBlockWithInvalidInput(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	to := string(newTestWallet(t, 2, KeyTypeP256).GetAddress())
+	bc := newTestChain(t, miner)
+	for _, test := range []struct {
+		name   string
+		modify func(input *TxInput)
+	}{
+		{"missing transaction", func(input *TxInput) { input.TXHash = []byte("missing") }},
+		{"vout out of range", func(input *TxInput) { input.Vout = 99 }},
+	} {
+		tx := newTestTransaction(t, bc, miner, map[string]float64{to: 1}, TxOptions{})
+		test.modify(tx.TxInputs[0])
+		if _, err := bc.mineBlock(string(miner.GetAddress()), []*transaction{tx}); err == nil {
+			t.Errorf("%s：交易被打包", test.name)
+		}
+		if _, err := bc.transactionFee(tx); err == nil {
+			t.Errorf("%s：计算出了手续费", test.name)
+		}
+	}
+}
+
+//每个网络的创世块由网络参数唯一确定，其他网络或旧版本创建的区块链不能打开
+func TestGenesisBlock(t *testing.T) {
+	defer SelectNetwork(regTestParams.Name)
+	for _, params := range chainParamsList {
+		if err := SelectNetwork(params.Name); err != nil {
+			t.Fatal(err)
+		}
+		if genesis := NewGenesisBlock(); !bytes.Equal(genesis.Hash, params.GenesisHash) {
+			t.Fatalf("%s网络的创世块哈希值为%x，应为%x", params.Name, genesis.Hash, params.GenesisHash)
+		}
+	}
+	SelectNetwork(regTestParams.Name)
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	bc := newTestChain(t, miner)
+	//其他创世块被拒绝
+	other := NewBlock(0, activeNetParams.GenesisPrevBlockHash, []*transaction{NewCoinbaseTransaction(string(miner.GetAddress()))})
+	if err := bc.AddBlockToBlockchain(other); err == nil {
+		t.Fatal("其他创世块被接受")
+	}
+	if err := SelectNetwork(testNetParams.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.checkGenesisBlock(); err == nil {
+		t.Fatal("在testnet中打开了regtest的区块链")
+	}
+}
@@ -0,0 +1,101 @@
+package blc
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+)
+
+//保存在BoltDB数据库文件中的存储，每个表对应数据库中的一个bucket
+type boltStore struct {
+	db *bolt.DB
+}
+
+//打开或创建BoltDB数据库文件
+func OpenBoltStore(path string) (ChainStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+func (store *boltStore) View(fn func(tx *StoreTx) error) error {
+	return store.db.View(func(boltTx *bolt.Tx) error {
+		return fn(&StoreTx{boltStoreTx{boltTx}})
+	})
+}
+
+func (store *boltStore) Update(fn func(tx *StoreTx) error) error {
+	return store.db.Update(func(boltTx *bolt.Tx) error {
+		return fn(&StoreTx{boltStoreTx{boltTx}})
+	})
+}
+
+func (store *boltStore) Close() error {
+	return store.db.Close()
+}
+
+//BoltDB的事务
+type boltStoreTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltStoreTx) get(table string, key []byte) []byte {
+	bucket := t.tx.Bucket([]byte(table))
+	if bucket == nil {
+		return nil
+	}
+	//BoltDB返回的值只在事务中有效，复制一份返回
+	value := bucket.Get(key)
+	if value == nil {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
+
+func (t boltStoreTx) put(table string, key, value []byte) error {
+	bucket, err := t.tx.CreateBucketIfNotExists([]byte(table))
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
+
+func (t boltStoreTx) delete(table string, key []byte) error {
+	bucket := t.tx.Bucket([]byte(table))
+	if bucket == nil {
+		return nil
+	}
+	return bucket.Delete(key)
+}
+
+func (t boltStoreTx) forEach(table string, fn func(key, value []byte) error) error {
+	bucket := t.tx.Bucket([]byte(table))
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(fn)
+}
+
+//用游标直接定位到第一个以prefix开头的键
+func (t boltStoreTx) forEachPrefix(table string, prefix []byte, fn func(key, value []byte) error) error {
+	bucket := t.tx.Bucket([]byte(table))
+	if bucket == nil {
+		return nil
+	}
+	c := bucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		err := fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t boltStoreTx) deleteTable(table string) error {
+	if t.tx.Bucket([]byte(table)) == nil {
+		return nil
+	}
+	return t.tx.DeleteBucket([]byte(table))
+}
@@ -1,23 +1,62 @@
 package blc
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //命令使用说明
 const usage = `
-	createChain --address <ADDRESS>  			"创建区块链"
-	send --from <FROM> --to <TO>  				"转账, 例如: send --from Tom --to Alice:10,Jack:12
-	getBalance --address <ADDRESS>				"获取余额"
+	--network <mainnet|testnet|regtest> <COMMAND>		"所有命令都可以指定网络，默认为mainnet，不同网络的地址前缀和数据文件互不相同，regtest不需要工作量证明，可以立即出块；没有设置NODE_ID环境变量时使用网络的默认端口（3000、13000、23000）"
+	--datadir <DIR> [--config <FILE>] <COMMAND>		"所有命令都可以指定数据目录和配置文件，配置文件默认为数据目录中的spc.toml，优先级：命令行参数 > 环境变量（NODE_ID、SPC_DATADIR、SPC_NETWORK、SPC_MINER、SPC_CONFIG） > 配置文件"
+	--unlock <COMMAND>						"钱包加密后，需要签名的命令都要加上--unlock，从标准输入读取钱包密码，例如: spc --unlock send ... < passphrase.txt，解锁只在该命令执行期间有效（startNode最多5分钟），密钥只保存在内存中，不会写入磁盘"
+	--datacarriersize <N> <COMMAND>				"所有命令都可以指定数据输出最多携带的字节数，默认为80，也可以在配置文件中设置datacarriersize；这是本节点创建和转发交易时的策略，不能超过共识规则中的80字节，校验区块时始终使用共识规则中的限制"
+	createChain --address <ADDRESS>  			"创建区块链：写入当前网络固定的创世块，并挖出第一个区块，第一个区块的挖矿奖励发给ADDRESS"
+	send --from <FROM> --to <TO> [--locktime <N>] [--sequence <N>] [--sequenceTime <SECONDS>] [--data <HEX>] [--file <FILE>]	"转账, 例如: send --from Tom --to Alice:10,Jack:12，可以设置锁定时间和附加数据，指定--file时将签名后的交易保存到文件而不打包，从只读地址转出时保存部分签名交易"
+		[--strategy <largest|smallest|bnb>] [--feeRate <RATE>] [--inputs <TXID:VOUT,...>]	"选币策略默认为bnb（尽量不找零），feeRate为每字节的手续费，指定--inputs时只使用这些UTXO"
+	listUnspent --address <ADDRESS>					"列出地址的所有UTXO"
+	createrawtx --from <FROM> --to <TO> --file <FILE> [--redeemScript <SCRIPT>] [--locktime <N>] [--strategy <STRATEGY>] [--feeRate <RATE>] [--inputs <TXID:VOUT,...>]	"创建部分签名交易，交易中包含签名所需的输出，从P2SH地址转出时需要提供赎回脚本"
+	signrawtx --file <FILE>						"用钱包中所有可以签名的地址对部分签名交易进行签名，不需要区块链数据"
+	combinetx --files <FILE1,FILE2> --file <FILE>		"合并多个部分签名交易中的签名，并保存到文件"
+	broadcasttx --file <FILE> --miner <ADDRESS>			"签名完成后，验证部分签名交易并打包到区块中"
+	findData --data <HEX>						"查找附加了指定数据的区块及确认数，配置文件中设置dataindex = true时使用数据索引"
+	sendRawTx --file <FILE> --miner <ADDRESS>			"将文件中已签名的交易打包到区块中，交易未到锁定时间时会被拒绝"
+	getBalance [--address <ADDRESS>]				"获取余额，不指定地址时显示钱包中所有地址（包括只读地址）的余额"
 	printChain									"打印区块链信息"
-	createWallet								"创建钱包"
-	getAddressList								"获取所有钱包地址"
-	startNode --miner <ADDRESS>					"启动节点服务器，并且指定挖矿奖励的地址"
+	reindex										"重建区块高度索引，配置文件中设置txindex = true、addrindex = true或dataindex = true时同时重建交易索引、地址索引或数据索引"
+	getAddressHistory --address <ADDRESS>			"显示任何地址的交易历史（从新到旧），需要在配置文件中设置addrindex = true"
+	createWallet [--passphrase <PASSPHRASE>] [--keyType <p256|secp256k1|schnorr>] [--bech32]	"创建钱包，第一次创建时生成助记词，可以设置助记词的密码，密钥类型默认为p256，指定--bech32时显示Bech32格式的地址"
+	getAddressList [--bech32]						"获取所有钱包地址，指定--bech32时显示Bech32格式的地址"
+	validateAddress --address <ADDRESS>				"校验Base58Check或Bech32地址，地址输错时提示可能出错的位置"
+	listTransactions [--address <ADDRESS>] [--limit <N>]	"显示地址的交易记录（从新到旧），不指定地址时显示钱包中所有地址的交易记录，默认每个地址显示10条"
+	setLabel --address <ADDRESS> | --txid <TXID> --label <LABEL>	"设置地址或交易的标签，标签为空时删除标签"
+	wallet backup [--mnemonic]						"备份钱包，显示HD钱包的种子或助记词，只需备份种子或助记词即可恢复所有地址"
+	wallet restore --seed <SEED> | --mnemonic "<WORDS>" [--passphrase <PASSPHRASE>]	"由种子或助记词恢复钱包，并扫描区块链找回使用过的地址及余额"
+	wallet xpub									"显示钱包账户的扩展公钥"
+	wallet derive --xpub <XPUB> --index <N>			"由扩展公钥派生第N个地址，不需要私钥"
+	watchAddress --address <ADDRESS> [--pubkey <PUBKEY>]	"添加只读地址，可以查看余额并创建部分签名交易"
+	watchXpub --xpub <XPUB>						"添加扩展公钥，将派生出的地址作为只读地址"
+	signMessage --address <ADDRESS> --message <MESSAGE>	"用地址的私钥对消息签名，证明拥有该地址"
+	verifyMessage --address <ADDRESS> --signature <SIGNATURE> --message <MESSAGE>	"验证消息的签名是否由该地址的私钥生成"
+	exportKey --address <ADDRESS>					"导出地址的私钥，任何人得到私钥都可以花费该地址中的币"
+	importKey <KEY> | --key <KEY>					"导入私钥，并扫描区块链，将该地址的交易记录加入钱包账本"
+	encryptWallet							"从标准输入读取密码并加密钱包文件，加密后需要签名的命令都要加上--unlock"
+	changePassphrase							"从标准输入依次读取原密码和新密码，修改钱包密码"
+	startNode [--miner <ADDRESS>] [--listen <HOST:PORT>] [--externalAddr <HOST:PORT>]	"启动节点服务器，并且指定挖矿奖励的地址，没有指定的参数使用配置文件或环境变量中的值"
+	createMultisig --m <M> --pubkeys <PUBKEYS> [--p2sh]		"创建m-of-n多重签名地址, 例如: createMultisig --m 2 --pubkeys PK1,PK2,PK3，指定--p2sh时创建P2SH地址，从该地址转出时使用createrawtx、signrawtx、combinetx和broadcasttx"
+	initiateSwap --from <FROM> --to <TO> --amount <AMOUNT> --locktime <N> [--secretHash <HASH>]	"创建哈希时间锁合约，不指定秘密值哈希时随机生成秘密值"
+	redeemSwap --contract <CONTRACT> --txid <TXID> --secret <SECRET>	"收款方提供秘密值领取合约中的币"
+	refundSwap --contract <CONTRACT> --txid <TXID>			"到达锁定时间后，汇款方取回合约中的币"
+	auditSwap --contract <CONTRACT> --txid <TXID>			"查看合约的内容和状态，合约已被领取时显示秘密值"
 `
 
 const createChain = "createChain"
@@ -28,12 +67,64 @@ const getBalance = "getBalance"
 
 const printChain = "printChain"
 
+const reindex = "reindex"
+
+const getAddressHistory = "getAddressHistory"
+
 const createWallet = "createWallet"
 
 const getAddressList = "getAddressList"
 
+const validateAddress = "validateAddress"
+
+const walletCmd = "wallet"
+
+const watchAddress = "watchAddress"
+
+const watchXpub = "watchXpub"
+
+const createRawTx = "createrawtx"
+
+const signRawTx = "signrawtx"
+
+const combineTx = "combinetx"
+
+const broadcastTx = "broadcasttx"
+
+const exportKey = "exportKey"
+
+const importKey = "importKey"
+
+const encryptWallet = "encryptWallet"
+
+const changePassphrase = "changePassphrase"
+
 const startNode = "startNode"
 
+const sendRawTx = "sendRawTx"
+
+const findData = "findData"
+
+const listTransactions = "listTransactions"
+
+const signMessage = "signMessage"
+
+const verifyMessage = "verifyMessage"
+
+const setLabel = "setLabel"
+
+const listUnspent = "listUnspent"
+
+const createMultisig = "createMultisig"
+
+const initiateSwap = "initiateSwap"
+
+const redeemSwap = "redeemSwap"
+
+const refundSwap = "refundSwap"
+
+const auditSwap = "auditSwap"
+
 type CLI struct{}
 
 func (cli *CLI) printUsage() {
@@ -42,21 +133,685 @@ func (cli *CLI) printUsage() {
 }
 
 func (cli *CLI) createChain(address, nodeId string) {
-	if !ValidateAddress(address) {
-		log.Panic("收款人地址" + address + "无效")
-	}
+	cli.checkAddress("收款人", address)
 	bc := CreateBlockChain(address, nodeId)
-	defer bc.Db.Close()
+	defer bc.Close()
 	log.Println("区块链创建成功")
 }
 
 func (cli *CLI) Send(sendCmdFromParam,
-	sendCmdToParam, nodeId string) {
-	if !ValidateAddress(sendCmdFromParam) {
-		log.Panic("汇款人地址" + sendCmdFromParam + "无效")
+	sendCmdToParam string, opts TxOptions, fileName, nodeId string) {
+	cli.checkAddress("汇款人", sendCmdFromParam)
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	tos := cli.parseTos(sendCmdToParam)
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	//从只读地址转出时，只能创建部分签名交易
+	if _, ok := wf.WatchOnly[canonicalAddress(sendCmdFromParam)]; ok {
+		if fileName == "" {
+			log.Fatal("汇款人地址为只读地址，请使用--file将部分签名交易保存到文件")
+		}
+		ptx, err := NewWatchOnlyTransaction(sendCmdFromParam, tos, opts, bc)
+		if err != nil {
+			log.Panic(err)
+		}
+		err = ptx.SaveToFile(fileName)
+		if err != nil {
+			log.Panic(err)
+		}
+		log.Printf("部分签名交易已保存到%s，请使用signrawtx命令离线签名后再通过broadcasttx命令打包", fileName)
+		return
+	}
+	tx := NewTransaction(sendCmdFromParam, tos, opts, bc)
+	if fileName != "" {
+		err = tx.SaveToFile(fileName)
+		if err != nil {
+			log.Panic(err)
+		}
+		log.Printf("交易已保存到%s，可以通过sendRawTx命令打包到区块中", fileName)
+		return
+	}
+	//每一次交易都会打包一个区块，这是不对的，应该是将一定的时间内的所有交易一起打包成一个区块，以后会进行完善
+	if err := bc.AddBlock(sendCmdFromParam, []*transaction{tx}); err != nil {
+		log.Println("交易被拒绝：" + err.Error())
+		return
+	}
+	log.Println("交易创建成功")
+}
+
+func (cli *CLI) createRawTx(from, to, redeemScriptHex string, opts TxOptions, fileName, nodeId string) {
+	var redeemScript []byte
+	if redeemScriptHex != "" {
+		var err error
+		redeemScript, err = hex.DecodeString(redeemScriptHex)
+		if err != nil {
+			log.Panic("赎回脚本" + redeemScriptHex + "无效")
+		}
+	}
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	ptx, err := NewPartialTx(from, redeemScript, cli.parseTos(to), opts, bc)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = ptx.SaveToFile(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	inputTotal, outputTotal := ptx.Amounts()
+	log.Printf("部分签名交易已保存到%s，共%d个输入，输入总额为：%f，输出总额为：%f，手续费为：%f", fileName, len(ptx.Inputs), inputTotal, outputTotal, inputTotal-outputTotal)
+}
+
+func (cli *CLI) signRawTx(fileName, nodeId string) {
+	ptx, err := LoadPartialTx(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets, err := getAllWallets(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	count := 0
+	for _, wallet := range wallets {
+		n, err := ptx.Sign(wallet)
+		if err != nil {
+			log.Panic(err)
+		}
+		count += n
+	}
+	if count == 0 {
+		log.Fatal("钱包中没有可以对该交易签名的地址")
+	}
+	err = ptx.SaveToFile(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	inputTotal, outputTotal := ptx.Amounts()
+	log.Printf("已添加%d个签名，输入总额为：%f，输出总额为：%f，交易已保存到%s", count, inputTotal, outputTotal, fileName)
+}
+
+func (cli *CLI) combineTx(files, fileName string) {
+	var ptx *PartialTx
+	for _, file := range strings.Split(files, ",") {
+		other, err := LoadPartialTx(file)
+		if err != nil {
+			log.Panic(err)
+		}
+		if ptx == nil {
+			ptx = other
+			continue
+		}
+		err = ptx.Combine(other)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	err := ptx.SaveToFile(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	if _, err := ptx.Finalize(); err != nil {
+		log.Printf("签名已合并到%s，%v", fileName, err)
+		return
+	}
+	log.Printf("签名已合并到%s，签名已完成，可以通过broadcasttx命令打包", fileName)
+}
+
+func (cli *CLI) broadcastTx(fileName, minerAddr, nodeId string) {
+	cli.checkAddress("矿工", minerAddr)
+	ptx, err := LoadPartialTx(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := ptx.Finalize()
+	if err != nil {
+		log.Panic(err)
+	}
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	if err := bc.AddBlock(minerAddr, []*transaction{tx}); err != nil {
+		log.Println("交易被拒绝：" + err.Error())
+		return
+	}
+	log.Printf("交易%x打包成功", tx.TxHash)
+}
+
+func (cli *CLI) sendRawTx(fileName, minerAddr, nodeId string) {
+	cli.checkAddress("矿工", minerAddr)
+	tx, err := LoadTransaction(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	if err := bc.AddBlock(minerAddr, []*transaction{tx}); err != nil {
+		log.Println("交易被拒绝：" + err.Error())
+		return
+	}
+	log.Println("交易打包成功")
+}
+
+func (cli *CLI) listUnspent(address, nodeId string) {
+	cli.checkAddress("", address)
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	utxoMap := bc.FindUTXOAndTxHashForAddress(address)
+	var txHashes []string
+	for txHashStr := range utxoMap {
+		txHashes = append(txHashes, txHashStr)
+	}
+	sort.Strings(txHashes)
+	for _, txHashStr := range txHashes {
+		for _, utxo := range utxoMap[txHashStr] {
+			log.Printf("%s:%d，金额为：%f", txHashStr, utxo.Vout, utxo.Output.Value)
+		}
+	}
+}
+
+//解析选币相关的参数
+func (cli *CLI) coinSelectionOptions(opts *TxOptions, strategy string, feeRate float64, inputs string) {
+	opts.Strategy = strategy
+	opts.FeeRate = feeRate
+	if inputs != "" {
+		outPoints, err := ParseOutPoints(inputs)
+		if err != nil {
+			log.Panic(err)
+		}
+		opts.Inputs = outPoints
+	}
+}
+
+func (cli *CLI) listTransactions(address string, limit int, nodeId string) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	var addresses []string
+	if address != "" {
+		cli.checkAddress("", address)
+		addresses = append(addresses, canonicalAddress(address))
+	} else {
+		for address := range wf.Wallets {
+			addresses = append(addresses, address)
+		}
+		for address := range wf.WatchOnly {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+	}
+	//有标签的地址或交易显示标签
+	withLabel := func(key string) string {
+		if label, ok := wf.Labels[key]; ok {
+			return key + "（" + label + "）"
+		}
+		return key
+	}
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	ledger := WalletLedger{bc}
+	for _, address := range addresses {
+		entries, err := ledger.ListTransactions(address, limit)
+		if err != nil {
+			log.Panic(err)
+		}
+		watchOnly := ""
+		if _, ok := wf.WatchOnly[address]; ok {
+			watchOnly = "（只读）"
+		}
+		log.Printf("%s%s的交易记录：", withLabel(address), watchOnly)
+		for _, entry := range entries {
+			var counterparties []string
+			for _, counterparty := range entry.Counterparties {
+				counterparties = append(counterparties, withLabel(counterparty))
+			}
+			log.Printf("%s%s，区块高度：%d，时间：%s，类别：%s，金额：%+f，手续费：%f，交易对方：%s",
+				withLabel(hex.EncodeToString(entry.TxHash)), watchOnly, entry.Height,
+				time.Unix(entry.Timestamp, 0).Format("2006-01-02 15:04:05"), entry.Category, entry.Amount, entry.Fee,
+				strings.Join(counterparties, ","))
+		}
+	}
+}
+
+func (cli *CLI) signMessage(address, message, nodeId string) {
+	signature, err := SignMessage(nodeId, address, message)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("签名为：%s", signature)
+}
+
+func (cli *CLI) verifyMessage(address, signature, message string) {
+	err := VerifyMessage(address, signature, message)
+	if err != nil {
+		log.Fatal("签名验证失败：", err)
+	}
+	log.Printf("签名验证成功，消息由%s的私钥签名", address)
+}
+
+func (cli *CLI) setLabel(address, txHash, label, nodeId string) {
+	key := address
+	if address != "" {
+		cli.checkAddress("", address)
+	} else {
+		if _, err := hex.DecodeString(txHash); err != nil {
+			log.Panic("交易哈希" + txHash + "无效")
+		}
+		key = txHash
+	}
+	err := SetLabel(nodeId, key, label)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if label == "" {
+		log.Printf("已删除%s的标签", key)
+		return
+	}
+	log.Printf("%s的标签已设置为：%s", key, label)
+}
+
+func (cli *CLI) findData(dataHex, nodeId string) {
+	data, err := hex.DecodeString(dataHex)
+	if err != nil {
+		log.Panic("数据" + dataHex + "不是十六进制格式")
+	}
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	locations := bc.FindData(data)
+	if len(locations) == 0 {
+		log.Println("区块链中不存在附加了该数据的交易")
+		return
+	}
+	for _, location := range locations {
+		log.Printf("区块高度：%d，区块哈希：%x，区块时间：%s，交易哈希：%x，确认数：%d",
+			location.Height, location.BlockHash, time.Unix(location.Timestamp, 0).Format("2006-01-02 15:04:05"), location.TxHash, location.Confirmations)
+	}
+}
+
+func (cli *CLI) printChain(nodeId string) {
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	bc.PrintChain()
+}
+
+func (cli *CLI) reindex(nodeId string) {
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	err := bc.Reindex()
+	if err != nil {
+		log.Panic(err)
+	}
+	indexes := "区块高度索引"
+	if cfg.TxIndex {
+		indexes += "、交易索引"
+	}
+	if cfg.AddrIndex {
+		indexes += "、地址索引"
+	}
+	log.Printf("已重建%s，当前区块高度%d", indexes, bc.GetBestHeight())
+}
+
+func (cli *CLI) getAddressHistory(address, nodeId string) {
+	cli.checkAddress("", address)
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	history, err := bc.GetAddressHistory(address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s的交易历史：", address)
+	for i := len(history) - 1; i >= 0; i-- {
+		tx := history[i]
+		log.Printf("%x，区块高度：%d，收款：%f，付款：%f", tx.TxHash, tx.Height, tx.Received, tx.Spent)
+	}
+}
+
+func (cli *CLI) getBalance(address, nodeId string) {
+	cli.checkAddress("余额", address)
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	balance := bc.GetBalance(address)
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	if _, ok := wf.WatchOnly[canonicalAddress(address)]; ok {
+		log.Printf("%s（只读）的余额为：%f", address, balance)
+		return
+	}
+	log.Printf("%s的余额为：%f", address, balance)
+}
+
+//显示钱包中所有地址的余额，只读地址的余额单独统计
+func (cli *CLI) getWalletBalance(nodeId string) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
 	}
 	bc := GetBlockChain(nodeId)
-	defer bc.Db.Close()
+	defer bc.Close()
+	var total, watchOnlyTotal float64
+	for address := range wf.Wallets {
+		balance := bc.GetBalance(address)
+		total += balance
+		log.Printf("%s的余额为：%f", address, balance)
+	}
+	for address := range wf.WatchOnly {
+		balance := bc.GetBalance(address)
+		watchOnlyTotal += balance
+		log.Printf("%s（只读）的余额为：%f", address, balance)
+	}
+	log.Printf("钱包总余额为：%f，只读地址总余额为：%f", total, watchOnlyTotal)
+}
+
+func (cli *CLI) createWallet(passphrase, keyTypeName string, bech32 bool, nodeId string) {
+	scheme, err := schemeByName(keyTypeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wallet := NewWallet(nodeId, passphrase, scheme.keyType())
+	address := string(wallet.GetAddress())
+	if bech32 {
+		address, err = wallet.GetBech32Address()
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	log.Printf("钱包创建成功，地址为：%s", address)
+}
+
+func (cli *CLI) getAddressList(bech32 bool, nodeId string) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	//指定--bech32时显示地址的Bech32格式，不支持Bech32的地址仍显示Base58Check格式
+	format := func(address string) string {
+		if !bech32 {
+			return address
+		}
+		if encoded, err := Bech32Address(address); err == nil {
+			return encoded
+		}
+		return address
+	}
+	i := 0
+	for address, wallet := range wf.Wallets {
+		i++
+		if label, ok := wf.Labels[address]; ok {
+			log.Printf("第%d个地址为：%s（%s），密钥类型为：%s，公钥为：%x\n", i, format(address), label, wallet.scheme().name(), wallet.PublicKey)
+			continue
+		}
+		log.Printf("第%d个地址为：%s，密钥类型为：%s，公钥为：%x\n", i, format(address), wallet.scheme().name(), wallet.PublicKey)
+	}
+	for address, watch := range wf.WatchOnly {
+		i++
+		if watch.Xpub != "" {
+			log.Printf("第%d个地址为：%s（只读，由扩展公钥派生，路径为%s），公钥为：%x\n", i, format(address), watch.Path, watch.PublicKey)
+			continue
+		}
+		log.Printf("第%d个地址为：%s（只读），公钥为：%x\n", i, format(address), watch.PublicKey)
+	}
+}
+
+//校验命令行参数中的地址，地址无效时输出无效的原因，例如出错字符的位置
+func (cli *CLI) checkAddress(role, address string) {
+	if _, err := ParseAddress(address); err != nil {
+		log.Panic(role + err.Error())
+	}
+}
+
+func (cli *CLI) validateAddress(address string) {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var addressType string
+	switch addr.Version {
+	case activeNetParams.MultisigAddrID:
+		addressType = "多重签名地址"
+	case activeNetParams.ScriptHashAddrID:
+		addressType = "P2SH地址"
+	default:
+		scheme, _ := schemeByAddressVersion(addr.Version)
+		addressType = "公钥哈希地址，密钥类型为" + scheme.name()
+	}
+	bech32Address, err := addr.Bech32()
+	if err != nil {
+		bech32Address = "不支持"
+	}
+	log.Printf("地址有效，类型为：%s，Base58Check格式为：%s，Bech32格式为：%s", addressType, addr, bech32Address)
+}
+
+func (cli *CLI) walletBackup(mnemonic bool, nodeId string) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	if wf.isLocked() {
+		log.Fatal(errWalletLocked)
+	}
+	if wf.Seed == nil {
+		log.Fatal("钱包中没有种子，请先创建钱包")
+	}
+	if !mnemonic {
+		log.Printf("钱包种子为：%x，请妥善保管，任何人得到种子都可以花费钱包中的币", wf.Seed)
+		return
+	}
+	if wf.Mnemonic == "" {
+		log.Fatal("钱包的种子不是由助记词生成的，请使用wallet backup备份种子")
+	}
+	log.Printf("钱包助记词为：%s", wf.Mnemonic)
+	log.Println("请按顺序抄写并妥善保管，创建钱包时设置了密码的，恢复时还需要提供同样的密码")
+}
+
+func (cli *CLI) walletRestore(seedHex, mnemonic, passphrase, nodeId string) {
+	//扫描区块链，找出使用过的地址
+	isUsed := func(pubKeyHash []byte) bool { return false }
+	chainExist := dbExist(dataFileName(dbName, nodeId))
+	if chainExist {
+		bc := GetBlockChain(nodeId)
+		used := bc.usedPubKeyHashes()
+		bc.Close()
+		isUsed = func(pubKeyHash []byte) bool { return used[hex.EncodeToString(pubKeyHash)] }
+	}
+	var addresses []string
+	var err error
+	if mnemonic != "" {
+		addresses, err = RestoreWalletFromMnemonic(nodeId, mnemonic, passphrase, isUsed)
+	} else {
+		seed, decodeErr := hex.DecodeString(seedHex)
+		if decodeErr != nil || len(seed) < 16 {
+			log.Panic("种子" + seedHex + "无效")
+		}
+		addresses, err = RestoreWallet(nodeId, seed, isUsed)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	for i, address := range addresses {
+		log.Printf("恢复的第%d个地址为：%s", i+1, address)
+	}
+	if chainExist {
+		bc := GetBlockChain(nodeId)
+		defer bc.Close()
+		for _, address := range addresses {
+			log.Printf("%s的余额为：%f", address, bc.GetBalance(address))
+		}
+	}
+}
+
+func (cli *CLI) walletXpub(nodeId string) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	accountKey, err := wf.accountKey()
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("账户%s的扩展公钥为：%s", hdAccountPath(), accountKey.Neuter())
+}
+
+func (cli *CLI) walletDerive(xpub string, index uint32) {
+	accountKey, err := ParseExtendedKey(xpub)
+	if err != nil {
+		log.Panic(err)
+	}
+	key, err := accountKey.Child(0)
+	if err == nil {
+		key, err = key.Child(index)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("第%d个地址为：%s", index, key.Address())
+}
+
+func (cli *CLI) watchAddress(address, pubKeyHex, nodeId string) {
+	var pubKey []byte
+	if pubKeyHex != "" {
+		var err error
+		pubKey, err = hex.DecodeString(pubKeyHex)
+		if err != nil {
+			log.Panic("公钥" + pubKeyHex + "无效")
+		}
+	}
+	err := AddWatchOnlyAddress(nodeId, address, pubKey)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("已添加只读地址：%s", address)
+}
+
+func (cli *CLI) watchXpub(xpub, nodeId string) {
+	isUsed := func(pubKeyHash []byte) bool { return false }
+	if dbExist(dataFileName(dbName, nodeId)) {
+		bc := GetBlockChain(nodeId)
+		used := bc.usedPubKeyHashes()
+		bc.Close()
+		isUsed = func(pubKeyHash []byte) bool { return used[hex.EncodeToString(pubKeyHash)] }
+	}
+	addresses, err := AddWatchOnlyXpub(nodeId, xpub, isUsed)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("已添加%d个只读地址", len(addresses))
+}
+
+func (cli *CLI) exportKey(address, nodeId string) {
+	key, err := ExportPrivateKey(nodeId, address)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("地址%s的私钥为：%s，请妥善保管", address, key)
+}
+
+func (cli *CLI) importKey(key, nodeId string) {
+	address, err := ImportPrivateKey(nodeId, key)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("私钥导入成功，地址为：%s", address)
+	if !dbExist(dataFileName(dbName, nodeId)) {
+		return
+	}
+	//UTXO池包含所有地址的输出，不需要重建，只需扫描区块链，将导入地址的交易记录写入钱包账本
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	ledger := &WalletLedger{bc}
+	err = ledger.scanAddresses([]string{address})
+	if err != nil {
+		log.Panic(err)
+	}
+	entries, err := ledger.ListTransactions(address, 0)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("扫描到%s的%d条交易记录", address, len(entries))
+	log.Printf("%s的余额为：%f", address, bc.GetBalance(address))
+}
+
+func (cli *CLI) encryptWallet(nodeId string) {
+	passphrase, err := readPassphrase("新的钱包密码：")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = EncryptWallet(nodeId, passphrase)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Println("钱包加密成功，请牢记密码，忘记密码时只能用助记词或种子恢复钱包")
+}
+
+func (cli *CLI) changePassphrase(nodeId string) {
+	oldPassphrase, err := readPassphrase("原钱包密码：")
+	if err != nil {
+		log.Fatal(err)
+	}
+	newPassphrase, err := readPassphrase("新的钱包密码：")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ChangeWalletPassphrase(nodeId, oldPassphrase, newPassphrase)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Println("钱包密码修改成功，钱包已锁定")
+}
+
+//解析wallet命令的子命令
+func (cli *CLI) wallet(nodeId string) {
+	if len(os.Args) < 3 {
+		cli.printUsage()
+	}
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	backupCmdMnemonic := backupCmd.Bool("mnemonic", false, "show the mnemonic instead of the seed")
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreCmdSeed := restoreCmd.String("seed", "", "wallet seed in hex")
+	restoreCmdMnemonic := restoreCmd.String("mnemonic", "", "mnemonic words separated by spaces")
+	restoreCmdPassphrase := restoreCmd.String("passphrase", "", "mnemonic passphrase")
+	deriveCmd := flag.NewFlagSet("derive", flag.ExitOnError)
+	deriveCmdXpub := deriveCmd.String("xpub", "", "account extended public key")
+	deriveCmdIndex := deriveCmd.Uint("index", 0, "address index")
+	switch os.Args[2] {
+	case "backup":
+		err := backupCmd.Parse(os.Args[3:])
+		if err != nil {
+			log.Panic(err)
+		}
+		cli.walletBackup(*backupCmdMnemonic, nodeId)
+	case "restore":
+		err := restoreCmd.Parse(os.Args[3:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if (*restoreCmdSeed == "") == (*restoreCmdMnemonic == "") {
+			log.Println("命令错误，请查看以下命令说明")
+			cli.printUsage()
+		}
+		cli.walletRestore(*restoreCmdSeed, *restoreCmdMnemonic, *restoreCmdPassphrase, nodeId)
+	case "xpub":
+		cli.walletXpub(nodeId)
+	case "derive":
+		err := deriveCmd.Parse(os.Args[3:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if *deriveCmdXpub == "" {
+			log.Println("命令错误，请查看以下命令说明")
+			cli.printUsage()
+		}
+		cli.walletDerive(*deriveCmdXpub, uint32(*deriveCmdIndex))
+	default:
+		cli.printUsage()
+	}
+}
+
+//解析转账命令中的收款人及金额，例如：Alice:10,Jack:12
+func (cli *CLI) parseTos(sendCmdToParam string) map[string]float64 {
 	tos := make(map[string]float64)
 	toArr := strings.Split(sendCmdToParam, ",")
 	for _, value := range toArr {
@@ -64,54 +819,164 @@ func (cli *CLI) Send(sendCmdFromParam,
 		if len(arr) != 2 {
 			log.Println("命令错误，请查看以下命令说明")
 			cli.printUsage()
-			return
-		} else {
-			to := arr[0]
-			if !ValidateAddress(to) {
-				log.Panic("收款人地址" + to + "无效")
-			}
-			amount, err := strconv.ParseFloat(arr[1], 64)
-			if err != nil {
-				log.Println("命令错误，金额不是float类型，请查看以下命令说明")
-				cli.printUsage()
-				return
-			}
-			tos[arr[0]] = amount
 		}
+		to := arr[0]
+		cli.checkAddress("收款人", to)
+		amount, err := strconv.ParseFloat(arr[1], 64)
+		if err != nil {
+			log.Println("命令错误，金额不是float类型，请查看以下命令说明")
+			cli.printUsage()
+		}
+		tos[to] = amount
 	}
-	tx := NewTransaction(sendCmdFromParam, tos, bc)
-	//每一次交易都会打包一个区块，这是不对的，应该是将一定的时间内的所有交易一起打包成一个区块，以后会进行完善
-	bc.AddBlock(sendCmdFromParam, nodeId, []*transaction{tx})
-	log.Println("交易创建成功")
+	return tos
 }
 
-func (cli *CLI) printChain(nodeId string) {
-	bc := GetBlockChain(nodeId)
-	defer bc.Db.Close()
-	bc.PrintChain()
+func (cli *CLI) createMultisig(m int, pubKeysParam string, p2sh bool) {
+	var pubKeys [][]byte
+	for _, pubKeyHex := range strings.Split(pubKeysParam, ",") {
+		pubKey, err := hex.DecodeString(pubKeyHex)
+		if err != nil {
+			log.Panic("公钥" + pubKeyHex + "无效")
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	if p2sh {
+		redeemScript, err := buildMultisigScript(m, pubKeys)
+		if err != nil {
+			log.Panic(err)
+		}
+		log.Printf("%d-of-%d P2SH多重签名地址创建成功，地址为：%s", m, len(pubKeys), ScriptHashAddress(redeemScript))
+		log.Printf("赎回脚本为：%x，从该地址转出时需要提供赎回脚本", redeemScript)
+		return
+	}
+	address, err := NewMultisigAddress(m, pubKeys)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("%d-of-%d多重签名地址创建成功，地址为：%s", m, len(pubKeys), address)
 }
 
-func (cli *CLI) getBalance(address, nodeId string) {
-	if !ValidateAddress(address) {
-		log.Panic("余额地址" + address + "无效")
+func (cli *CLI) initiateSwap(from, to string, amount float64, lockTime int64, secretHashHex, nodeId string) {
+	var secretHash []byte
+	if secretHashHex == "" {
+		//发起方随机生成秘密值，交换完成前不能泄露
+		secret := make([]byte, htlcSecretSize)
+		_, err := rand.Read(secret)
+		if err != nil {
+			log.Panic(err)
+		}
+		hash := sha256.Sum256(secret)
+		secretHash = hash[:]
+		log.Printf("秘密值为：%x", secret)
+	} else {
+		var err error
+		secretHash, err = hex.DecodeString(secretHashHex)
+		if err != nil {
+			log.Panic("秘密值哈希" + secretHashHex + "无效")
+		}
 	}
 	bc := GetBlockChain(nodeId)
-	defer bc.Db.Close()
-	balance := bc.GetBalance(address)
-	log.Printf("%s的余额为：%f", address, balance)
+	defer bc.Close()
+	tx, contract, err := NewHTLCTransaction(from, to, amount, secretHash, lockTime, bc)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := bc.AddBlock(from, []*transaction{tx}); err != nil {
+		log.Println("交易被拒绝：" + err.Error())
+		return
+	}
+	log.Printf("秘密值哈希为：%x", secretHash)
+	log.Printf("合约为：%x", contract)
+	log.Printf("合约地址为：%s", ScriptHashAddress(contract))
+	log.Printf("合约交易哈希为：%x", tx.TxHash)
+}
+
+//读取合约参数及合约交易
+func (cli *CLI) loadSwap(contractHex, txHashHex string, bc *blockChain) ([]byte, *htlcContract, *transaction) {
+	contract, err := hex.DecodeString(contractHex)
+	if err != nil {
+		log.Panic("合约" + contractHex + "无效")
+	}
+	c, err := parseHTLCScript(contract)
+	if err != nil {
+		log.Panic(err)
+	}
+	txHash, err := hex.DecodeString(txHashHex)
+	if err != nil {
+		log.Panic("交易哈希" + txHashHex + "无效")
+	}
+	contractTx, err := bc.FindTransaction(txHash)
+	if err != nil {
+		log.Panic(err)
+	}
+	return contract, c, &contractTx
 }
 
-func (cli *CLI) createWallet(nodeId string) {
-	wallet := NewWallet(nodeId)
-	address := wallet.GetAddress()
-	log.Printf("钱包创建成功，地址为：%s", string(address))
+func (cli *CLI) spendSwap(contractHex, txHashHex, secretHex, nodeId string) {
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	contract, c, contractTx := cli.loadSwap(contractHex, txHashHex, bc)
+	wallets, err := getAllWallets(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	var secret []byte
+	pubKeyHash := c.RefundHash
+	if secretHex != "" {
+		secret, err = hex.DecodeString(secretHex)
+		if err != nil {
+			log.Panic("秘密值" + secretHex + "无效")
+		}
+		pubKeyHash = c.RecipientHash
+	}
+	wallet, err := findWalletByPubKeyHash(wallets, pubKeyHash)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := NewHTLCSpendTransaction(contract, contractTx, secret, wallet)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := bc.AddBlock(string(wallet.GetAddress()), []*transaction{tx}); err != nil {
+		log.Println("交易被拒绝：" + err.Error())
+		return
+	}
+	log.Printf("交易创建成功，交易哈希为：%x", tx.TxHash)
 }
 
-func (cli *CLI) getAddressList(nodeId string) {
-	allAddress := GetAllAddress(nodeId)
-	for i, address := range allAddress {
-		log.Printf("第%d个地址为：%s\n", i+1, address)
+func (cli *CLI) auditSwap(contractHex, txHashHex, nodeId string) {
+	bc := GetBlockChain(nodeId)
+	defer bc.Close()
+	contract, c, contractTx := cli.loadSwap(contractHex, txHashHex, bc)
+	vout, output, err := findContractOutput(contractTx, contract)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("合约地址：%s", ScriptHashAddress(contract))
+	log.Printf("合约金额：%f", output.Value)
+	log.Printf("收款方地址：%s", c.recipientAddress())
+	log.Printf("退款方地址：%s", c.refundAddress())
+	log.Printf("秘密值哈希：%x", c.SecretHash)
+	if c.LockTime < lockTimeThreshold {
+		log.Printf("锁定时间：区块高度%d，当前区块高度%d", c.LockTime, bc.GetBestHeight())
+	} else {
+		log.Printf("锁定时间：%s", time.Unix(c.LockTime, 0).Format("2006-01-02 15:04:05"))
 	}
+	if bc.isUnspent(contractTx.TxHash, vout) {
+		log.Println("合约状态：未花费")
+		return
+	}
+	spendingTx, inputIndex, err := bc.findSpendingTransaction(contractTx.TxHash, vout)
+	if err != nil {
+		log.Panic(err)
+	}
+	secret, err := extractHTLCSecret(spendingTx.TxInputs[inputIndex])
+	if err != nil {
+		log.Printf("合约状态：已退款，交易哈希为%x", spendingTx.TxHash)
+		return
+	}
+	log.Printf("合约状态：已领取，交易哈希为%x，秘密值为%x", spendingTx.TxHash, secret)
 }
 
 func (cli *CLI) paramsCheck() {
@@ -123,34 +988,142 @@ func (cli *CLI) paramsCheck() {
 }
 
 func (cli *CLI) startNode(nodeId, minerAddr string) {
-	if minerAddr != "" && ValidateAddress(minerAddr) {
-		//启动服务器
-		log.Println("启动服务器localhost:%s", nodeId)
-		startServer(nodeId, minerAddr)
-	} else {
+	if minerAddr == "" {
 		log.Fatal("指定的地址无效")
 	}
+	if _, err := ParseAddress(minerAddr); err != nil {
+		log.Fatal(err)
+	}
+	//启动服务器
+	log.Printf("启动服务器%s，公布的地址为%s", cfg.listenAddr(), cfg.externalAddr())
+	startServer(nodeId, minerAddr)
 }
 
 func (cli *CLI) Run() {
+	args, globalFlags, err := parseGlobalFlags(os.Args, []string{"unlock"}, "config", "datadir", "network", "datacarriersize")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Args = args
 	cli.paramsCheck()
-	nodeId := os.Getenv("NODE_ID")
-	if nodeId == "" {
-		log.Fatal("无法获取NODE_ID的环境变量")
+	err = loadConfig(globalFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	nodeId := getNodeId()
+	//密码从标准输入读取，不通过命令行参数传递
+	if globalFlags["unlock"] != "" {
+		passphrase, err := readPassphrase("钱包密码：")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = UnlockWallet(nodeId, passphrase, walletUnlockTimeout)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	fmt.Println(nodeId)
 	//命令解析器
 	createChainCmd := flag.NewFlagSet(createChain, flag.ExitOnError)
 	sendCmd := flag.NewFlagSet(send, flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet(getBalance, flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet(printChain, flag.ExitOnError)
+	reindexCmd := flag.NewFlagSet(reindex, flag.ExitOnError)
+	getAddressHistoryCmd := flag.NewFlagSet(getAddressHistory, flag.ExitOnError)
+	getAddressHistoryCmdAddress := getAddressHistoryCmd.String("address", "", "address to show the history of")
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
 	//获取命令中的参数值（以 -- 开头的参数的值）
 	createChainCmdParam := createChainCmd.String("address", "", "address info")
 	sendCmdFromParam := sendCmd.String("from", "", "source address info")
 	sendCmdToParam := sendCmd.String("to", "", "target address info")
+	sendCmdLockTime := sendCmd.Int64("locktime", 0, "block height or unix time before which the transaction cannot be mined")
+	sendCmdSequence := sendCmd.Int64("sequence", 0, "number of blocks the spent outputs must be confirmed for")
+	sendCmdSequenceTime := sendCmd.Int64("sequenceTime", 0, "number of seconds the spent outputs must be confirmed for")
+	sendCmdFile := sendCmd.String("file", "", "save the signed transaction to the file instead of mining it")
+	sendCmdData := sendCmd.String("data", "", "data in hex attached to the transaction as an unspendable output")
+	sendCmdStrategy := sendCmd.String("strategy", CoinSelectBranchAndBound, "coin selection strategy: largest, smallest or bnb")
+	sendCmdFeeRate := sendCmd.Float64("feeRate", 0, "fee per byte")
+	sendCmdInputs := sendCmd.String("inputs", "", "spend only these outputs, txid:vout separated by commas")
+	listUnspentCmd := flag.NewFlagSet(listUnspent, flag.ExitOnError)
+	listUnspentCmdAddress := listUnspentCmd.String("address", "", "address info")
+	listTransactionsCmd := flag.NewFlagSet(listTransactions, flag.ExitOnError)
+	listTransactionsCmdAddress := listTransactionsCmd.String("address", "", "address info")
+	listTransactionsCmdLimit := listTransactionsCmd.Int("limit", 10, "maximum number of transactions per address")
+	signMessageCmd := flag.NewFlagSet(signMessage, flag.ExitOnError)
+	signMessageCmdAddress := signMessageCmd.String("address", "", "address whose private key signs the message")
+	signMessageCmdMessage := signMessageCmd.String("message", "", "message to sign")
+	verifyMessageCmd := flag.NewFlagSet(verifyMessage, flag.ExitOnError)
+	verifyMessageCmdAddress := verifyMessageCmd.String("address", "", "address that signed the message")
+	verifyMessageCmdSignature := verifyMessageCmd.String("signature", "", "signature in base64")
+	verifyMessageCmdMessage := verifyMessageCmd.String("message", "", "signed message")
+	setLabelCmd := flag.NewFlagSet(setLabel, flag.ExitOnError)
+	setLabelCmdAddress := setLabelCmd.String("address", "", "address to label")
+	setLabelCmdTxHash := setLabelCmd.String("txid", "", "transaction hash to label")
+	setLabelCmdLabel := setLabelCmd.String("label", "", "label, empty to remove the label")
+	findDataCmd := flag.NewFlagSet(findData, flag.ExitOnError)
+	findDataCmdData := findDataCmd.String("data", "", "data in hex")
+	sendRawTxCmd := flag.NewFlagSet(sendRawTx, flag.ExitOnError)
+	sendRawTxCmdFile := sendRawTxCmd.String("file", "", "signed transaction file")
+	sendRawTxCmdMiner := sendRawTxCmd.String("miner", "", "miner address")
 	getBalanceCmdParam := getBalanceCmd.String("address", "", "address info")
 	startNodeCmdParam := startNodeCmd.String("miner", "", "miner address")
+	startNodeCmdListen := startNodeCmd.String("listen", "", "listen address, default localhost:NODE_ID")
+	startNodeCmdExternalAddr := startNodeCmd.String("externalAddr", "", "address advertised to other nodes, default the listen address")
+	watchAddressCmd := flag.NewFlagSet(watchAddress, flag.ExitOnError)
+	watchAddressCmdAddress := watchAddressCmd.String("address", "", "watch-only address")
+	watchAddressCmdPubKey := watchAddressCmd.String("pubkey", "", "public key of the address in hex")
+	watchXpubCmd := flag.NewFlagSet(watchXpub, flag.ExitOnError)
+	watchXpubCmdXpub := watchXpubCmd.String("xpub", "", "account extended public key")
+	createRawTxCmd := flag.NewFlagSet(createRawTx, flag.ExitOnError)
+	createRawTxCmdFrom := createRawTxCmd.String("from", "", "source address")
+	createRawTxCmdTo := createRawTxCmd.String("to", "", "target address info")
+	createRawTxCmdFile := createRawTxCmd.String("file", "", "partially signed transaction file")
+	createRawTxCmdRedeemScript := createRawTxCmd.String("redeemScript", "", "redeem script in hex, required for P2SH address")
+	createRawTxCmdLockTime := createRawTxCmd.Int64("locktime", 0, "block height or unix time before which the transaction cannot be mined")
+	createRawTxCmdStrategy := createRawTxCmd.String("strategy", CoinSelectBranchAndBound, "coin selection strategy: largest, smallest or bnb")
+	createRawTxCmdFeeRate := createRawTxCmd.Float64("feeRate", 0, "fee per byte")
+	createRawTxCmdInputs := createRawTxCmd.String("inputs", "", "spend only these outputs, txid:vout separated by commas")
+	signRawTxCmd := flag.NewFlagSet(signRawTx, flag.ExitOnError)
+	signRawTxCmdFile := signRawTxCmd.String("file", "", "partially signed transaction file")
+	combineTxCmd := flag.NewFlagSet(combineTx, flag.ExitOnError)
+	combineTxCmdFiles := combineTxCmd.String("files", "", "partially signed transaction files, separated by commas")
+	combineTxCmdFile := combineTxCmd.String("file", "", "output file")
+	broadcastTxCmd := flag.NewFlagSet(broadcastTx, flag.ExitOnError)
+	broadcastTxCmdFile := broadcastTxCmd.String("file", "", "partially signed transaction file")
+	broadcastTxCmdMiner := broadcastTxCmd.String("miner", "", "miner address")
+	exportKeyCmd := flag.NewFlagSet(exportKey, flag.ExitOnError)
+	exportKeyCmdAddress := exportKeyCmd.String("address", "", "wallet address")
+	importKeyCmd := flag.NewFlagSet(importKey, flag.ExitOnError)
+	importKeyCmdKey := importKeyCmd.String("key", "", "exported private key")
+	encryptWalletCmd := flag.NewFlagSet(encryptWallet, flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet(changePassphrase, flag.ExitOnError)
+	createWalletCmd := flag.NewFlagSet(createWallet, flag.ExitOnError)
+	createWalletCmdPassphrase := createWalletCmd.String("passphrase", "", "mnemonic passphrase, only used when the wallet seed is generated")
+	createWalletCmdKeyType := createWalletCmd.String("keyType", "p256", "key type: p256, secp256k1 or schnorr")
+	createWalletCmdBech32 := createWalletCmd.Bool("bech32", false, "show the address in bech32 format")
+	getAddressListCmd := flag.NewFlagSet(getAddressList, flag.ExitOnError)
+	getAddressListCmdBech32 := getAddressListCmd.Bool("bech32", false, "show addresses in bech32 format")
+	validateAddressCmd := flag.NewFlagSet(validateAddress, flag.ExitOnError)
+	validateAddressCmdAddress := validateAddressCmd.String("address", "", "address to validate")
+	createMultisigCmd := flag.NewFlagSet(createMultisig, flag.ExitOnError)
+	createMultisigCmdM := createMultisigCmd.Int("m", 0, "required signatures")
+	createMultisigCmdPubKeys := createMultisigCmd.String("pubkeys", "", "public keys in hex, separated by commas")
+	createMultisigCmdP2SH := createMultisigCmd.Bool("p2sh", false, "create a pay-to-script-hash address")
+	initiateSwapCmd := flag.NewFlagSet(initiateSwap, flag.ExitOnError)
+	initiateSwapCmdFrom := initiateSwapCmd.String("from", "", "sender address, also the refund address")
+	initiateSwapCmdTo := initiateSwapCmd.String("to", "", "recipient address")
+	initiateSwapCmdAmount := initiateSwapCmd.Float64("amount", 0, "amount locked in the contract")
+	initiateSwapCmdLockTime := initiateSwapCmd.Int64("locktime", 0, "block height or unix time after which the sender can refund")
+	initiateSwapCmdSecretHash := initiateSwapCmd.String("secretHash", "", "sha256 hash of the secret, generated randomly if empty")
+	redeemSwapCmd := flag.NewFlagSet(redeemSwap, flag.ExitOnError)
+	redeemSwapCmdContract := redeemSwapCmd.String("contract", "", "contract script in hex")
+	redeemSwapCmdTxHash := redeemSwapCmd.String("txid", "", "contract transaction hash")
+	redeemSwapCmdSecret := redeemSwapCmd.String("secret", "", "secret in hex")
+	refundSwapCmd := flag.NewFlagSet(refundSwap, flag.ExitOnError)
+	refundSwapCmdContract := refundSwapCmd.String("contract", "", "contract script in hex")
+	refundSwapCmdTxHash := refundSwapCmd.String("txid", "", "contract transaction hash")
+	auditSwapCmd := flag.NewFlagSet(auditSwap, flag.ExitOnError)
+	auditSwapCmdContract := auditSwapCmd.String("contract", "", "contract script in hex")
+	auditSwapCmdTxHash := auditSwapCmd.String("txid", "", "contract transaction hash")
 	//筛选命令中的第2个参数
 	switch os.Args[1] {
 	case createChain:
@@ -180,7 +1153,107 @@ func (cli *CLI) Run() {
 				cli.printUsage()
 				return
 			}
-			cli.Send(*sendCmdFromParam, *sendCmdToParam, nodeId)
+			opts := TxOptions{LockTime: *sendCmdLockTime}
+			if *sendCmdData != "" {
+				data, err := hex.DecodeString(*sendCmdData)
+				if err != nil {
+					log.Panic("数据" + *sendCmdData + "不是十六进制格式")
+				}
+				opts.Data = data
+			}
+			if *sendCmdSequence > 0 {
+				opts.Sequence = SequenceFromBlocks(*sendCmdSequence)
+			} else if *sendCmdSequenceTime > 0 {
+				opts.Sequence = SequenceFromSeconds(*sendCmdSequenceTime)
+			}
+			cli.coinSelectionOptions(&opts, *sendCmdStrategy, *sendCmdFeeRate, *sendCmdInputs)
+			cli.Send(*sendCmdFromParam, *sendCmdToParam, opts, *sendCmdFile, nodeId)
+		}
+	case listUnspent:
+		err := listUnspentCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if listUnspentCmd.Parsed() {
+			if *listUnspentCmdAddress == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.listUnspent(*listUnspentCmdAddress, nodeId)
+		}
+	case listTransactions:
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if listTransactionsCmd.Parsed() {
+			cli.listTransactions(*listTransactionsCmdAddress, *listTransactionsCmdLimit, nodeId)
+		}
+	case signMessage:
+		err := signMessageCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if signMessageCmd.Parsed() {
+			if *signMessageCmdAddress == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.signMessage(*signMessageCmdAddress, *signMessageCmdMessage, nodeId)
+		}
+	case verifyMessage:
+		err := verifyMessageCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if verifyMessageCmd.Parsed() {
+			if *verifyMessageCmdAddress == "" || *verifyMessageCmdSignature == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.verifyMessage(*verifyMessageCmdAddress, *verifyMessageCmdSignature, *verifyMessageCmdMessage)
+		}
+	case setLabel:
+		err := setLabelCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if setLabelCmd.Parsed() {
+			if (*setLabelCmdAddress == "") == (*setLabelCmdTxHash == "") {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.setLabel(*setLabelCmdAddress, *setLabelCmdTxHash, *setLabelCmdLabel, nodeId)
+		}
+	case findData:
+		err := findDataCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if findDataCmd.Parsed() {
+			if *findDataCmdData == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.findData(*findDataCmdData, nodeId)
+		}
+	case sendRawTx:
+		err := sendRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if sendRawTxCmd.Parsed() {
+			if *sendRawTxCmdFile == "" || *sendRawTxCmdMiner == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.sendRawTx(*sendRawTxCmdFile, *sendRawTxCmdMiner, nodeId)
 		}
 	case printChain:
 		err := printChainCmd.Parse(os.Args[2:])
@@ -190,6 +1263,27 @@ func (cli *CLI) Run() {
 		if printChainCmd.Parsed() {
 			cli.printChain(nodeId)
 		}
+	case reindex:
+		err := reindexCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if reindexCmd.Parsed() {
+			cli.reindex(nodeId)
+		}
+	case getAddressHistory:
+		err := getAddressHistoryCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if getAddressHistoryCmd.Parsed() {
+			if *getAddressHistoryCmdAddress == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.getAddressHistory(*getAddressHistoryCmdAddress, nodeId)
+		}
 	case getBalance:
 		err := getBalanceCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -197,30 +1291,254 @@ func (cli *CLI) Run() {
 		}
 		if getBalanceCmd.Parsed() {
 			if *getBalanceCmdParam == "" {
-				log.Println("命令错误，请查看以下命令说明")
-				cli.printUsage()
+				cli.getWalletBalance(nodeId)
 				return
 			}
 			//若命令校验成功，则调用相应方法
 			cli.getBalance(*getBalanceCmdParam, nodeId)
 		}
 	case createWallet:
-		cli.createWallet(nodeId)
+		err := createWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if createWalletCmd.Parsed() {
+			cli.createWallet(*createWalletCmdPassphrase, *createWalletCmdKeyType, *createWalletCmdBech32, nodeId)
+		}
 	case getAddressList:
-		cli.getAddressList(nodeId)
+		err := getAddressListCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if getAddressListCmd.Parsed() {
+			cli.getAddressList(*getAddressListCmdBech32, nodeId)
+		}
+	case validateAddress:
+		err := validateAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if validateAddressCmd.Parsed() {
+			if *validateAddressCmdAddress == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.validateAddress(*validateAddressCmdAddress)
+		}
+	case walletCmd:
+		cli.wallet(nodeId)
+	case watchAddress:
+		err := watchAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if watchAddressCmd.Parsed() {
+			if *watchAddressCmdAddress == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.watchAddress(*watchAddressCmdAddress, *watchAddressCmdPubKey, nodeId)
+		}
+	case watchXpub:
+		err := watchXpubCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if watchXpubCmd.Parsed() {
+			if *watchXpubCmdXpub == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.watchXpub(*watchXpubCmdXpub, nodeId)
+		}
+	case createRawTx:
+		err := createRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if createRawTxCmd.Parsed() {
+			if *createRawTxCmdFrom == "" || *createRawTxCmdTo == "" || *createRawTxCmdFile == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			opts := TxOptions{LockTime: *createRawTxCmdLockTime}
+			cli.coinSelectionOptions(&opts, *createRawTxCmdStrategy, *createRawTxCmdFeeRate, *createRawTxCmdInputs)
+			cli.createRawTx(*createRawTxCmdFrom, *createRawTxCmdTo, *createRawTxCmdRedeemScript, opts, *createRawTxCmdFile, nodeId)
+		}
+	case signRawTx:
+		err := signRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if signRawTxCmd.Parsed() {
+			if *signRawTxCmdFile == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.signRawTx(*signRawTxCmdFile, nodeId)
+		}
+	case combineTx:
+		err := combineTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if combineTxCmd.Parsed() {
+			if *combineTxCmdFiles == "" || *combineTxCmdFile == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.combineTx(*combineTxCmdFiles, *combineTxCmdFile)
+		}
+	case broadcastTx:
+		err := broadcastTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if broadcastTxCmd.Parsed() {
+			if *broadcastTxCmdFile == "" || *broadcastTxCmdMiner == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.broadcastTx(*broadcastTxCmdFile, *broadcastTxCmdMiner, nodeId)
+		}
+	case exportKey:
+		err := exportKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if exportKeyCmd.Parsed() {
+			if *exportKeyCmdAddress == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.exportKey(*exportKeyCmdAddress, nodeId)
+		}
+	case importKey:
+		err := importKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if importKeyCmd.Parsed() {
+			//私钥可以作为位置参数（importKey <KEY>），也可以用--key指定，只能使用其中一种
+			key := *importKeyCmdKey
+			if key == "" && importKeyCmd.NArg() == 1 {
+				key = importKeyCmd.Arg(0)
+			} else if importKeyCmd.NArg() != 0 {
+				key = ""
+			}
+			if key == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.importKey(key, nodeId)
+		}
+	case encryptWallet:
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if encryptWalletCmd.Parsed() {
+			cli.encryptWallet(nodeId)
+		}
+	case changePassphrase:
+		err := changePassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if changePassphraseCmd.Parsed() {
+			cli.changePassphrase(nodeId)
+		}
 	case startNode:
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
 		if startNodeCmd.Parsed() {
-			if *startNodeCmdParam == "" {
+			//命令行参数覆盖配置文件和环境变量
+			overrideString(&cfg.Node.Miner, *startNodeCmdParam)
+			overrideString(&cfg.Node.Listen, *startNodeCmdListen)
+			overrideString(&cfg.Node.ExternalAddr, *startNodeCmdExternalAddr)
+			if cfg.Node.Miner == "" {
 				log.Println("命令错误，请查看以下命令说明")
 				cli.printUsage()
 				return
 			}
 			//若命令校验成功，则调用相应方法
-			cli.startNode(nodeId, *startNodeCmdParam)
+			cli.startNode(nodeId, cfg.Node.Miner)
+		}
+	case createMultisig:
+		err := createMultisigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if createMultisigCmd.Parsed() {
+			if *createMultisigCmdM <= 0 || *createMultisigCmdPubKeys == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.createMultisig(*createMultisigCmdM, *createMultisigCmdPubKeys, *createMultisigCmdP2SH)
+		}
+	case initiateSwap:
+		err := initiateSwapCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if initiateSwapCmd.Parsed() {
+			if *initiateSwapCmdFrom == "" || *initiateSwapCmdTo == "" || *initiateSwapCmdAmount <= 0 || *initiateSwapCmdLockTime <= 0 {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.initiateSwap(*initiateSwapCmdFrom, *initiateSwapCmdTo, *initiateSwapCmdAmount, *initiateSwapCmdLockTime, *initiateSwapCmdSecretHash, nodeId)
+		}
+	case redeemSwap:
+		err := redeemSwapCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if redeemSwapCmd.Parsed() {
+			if *redeemSwapCmdContract == "" || *redeemSwapCmdTxHash == "" || *redeemSwapCmdSecret == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.spendSwap(*redeemSwapCmdContract, *redeemSwapCmdTxHash, *redeemSwapCmdSecret, nodeId)
+		}
+	case refundSwap:
+		err := refundSwapCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if refundSwapCmd.Parsed() {
+			if *refundSwapCmdContract == "" || *refundSwapCmdTxHash == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.spendSwap(*refundSwapCmdContract, *refundSwapCmdTxHash, "", nodeId)
+		}
+	case auditSwap:
+		err := auditSwapCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+		if auditSwapCmd.Parsed() {
+			if *auditSwapCmdContract == "" || *auditSwapCmdTxHash == "" {
+				log.Println("命令错误，请查看以下命令说明")
+				cli.printUsage()
+				return
+			}
+			cli.auditSwap(*auditSwapCmdContract, *auditSwapCmdTxHash, nodeId)
 		}
 	default:
 		cli.printUsage()
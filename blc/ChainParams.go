@@ -0,0 +1,199 @@
+package blc
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+//网络参数：不同的网络（主网、测试网、回归测试网）使用不同的创世区块、难度、挖矿奖励、地址前缀、端口、网络魔数和种子节点
+//不同网络的地址前缀不同，一个网络的地址不能在另一个网络中使用，数据文件也分别保存
+
+//网络参数
+type ChainParams struct {
+	//网络名称，也是--network参数的值
+	Name string
+	//网络魔数，节点之间的每条消息都以魔数开头，节点会丢弃其他网络的消息
+	Magic [4]byte
+	//节点的默认端口，没有设置NODE_ID环境变量时使用
+	DefaultPort string
+	//种子节点，第一个种子节点为主节点
+	Seeds []string
+	//数据文件所在的目录，主网的数据文件在当前目录中
+	DataDir string
+
+	//创世区块的上一个区块的哈希值
+	GenesisPrevBlockHash []byte
+	//创世区块的时间戳，每个网络不同，创世区块由网络参数唯一确定
+	GenesisTimestamp int64
+	//创世区块的哈希值，创建和打开区块链时校验，数据库中的创世区块与当前网络不一致时拒绝使用
+	GenesisHash []byte
+	//难度系数，表示生成的256位的哈希值的前面至少要有多少个零，为0时任何哈希值都有效，可以立即出块
+	TargetBits uint
+	//初始的挖矿奖励
+	BaseSubsidy float64
+	//挖矿奖励每隔多少个区块减半，为0时不减半
+	SubsidyHalvingInterval int64
+
+	//P-256公钥哈希地址的版本号
+	PubKeyHashAddrID byte
+	//secp256k1 ECDSA公钥哈希地址的版本号
+	Secp256k1AddrID byte
+	//Schnorr公钥哈希地址的版本号
+	SchnorrAddrID byte
+	//P2SH地址的版本号
+	ScriptHashAddrID byte
+	//多重签名地址的版本号
+	MultisigAddrID byte
+	//Bech32地址的人类可读前缀
+	Bech32HRP string
+	//导出私钥的版本号
+	PrivateKeyID byte
+	//扩展私钥和扩展公钥的版本号，与比特币不同，比特币的扩展密钥不能导入
+	HDPrivateKeyID []byte
+	HDPublicKeyID  []byte
+	//钱包派生路径中的币种（参照BIP44），与比特币的0不同，同一个种子在两条链上派生出的密钥互不相同
+	HDCoinType uint32
+}
+
+//主网
+var mainNetParams = ChainParams{
+	Name:        "mainnet",
+	Magic:       [4]byte{0xd3, 0x50, 0xc3, 0xe1},
+	DefaultPort: "3000",
+	Seeds:       []string{"localhost:3000"},
+	DataDir:     "",
+
+	GenesisPrevBlockHash:   make([]byte, 32),
+	GenesisTimestamp:       1672531200,
+	GenesisHash:            hexToBytes("0036ca28f2355a7d6599b67f0f64d90064017f5001b21dd212f19f785541ff7d"),
+	TargetBits:             10,
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 210000,
+
+	PubKeyHashAddrID: 0x00,
+	Secp256k1AddrID:  0x3f,
+	SchnorrAddrID:    0x41,
+	ScriptHashAddrID: 0x05,
+	MultisigAddrID:   0x32,
+	Bech32HRP:        "spc",
+	PrivateKeyID:     0x80,
+	//扩展私钥以sprv开头，扩展公钥以spub开头
+	HDPrivateKeyID: []byte{0x04, 0x20, 0xb9, 0x02},
+	HDPublicKeyID:  []byte{0x04, 0x20, 0xbd, 0x3c},
+	HDCoinType:     0x5350,
+}
+
+//测试网，难度与主网相同，地址前缀与主网不同
+var testNetParams = ChainParams{
+	Name:        "testnet",
+	Magic:       [4]byte{0x0d, 0x73, 0x70, 0x63},
+	DefaultPort: "13000",
+	Seeds:       []string{"localhost:13000"},
+	DataDir:     "testnet",
+
+	GenesisPrevBlockHash:   make([]byte, 32),
+	GenesisTimestamp:       1672531201,
+	GenesisHash:            hexToBytes("00126c0fd21d21b507005603908a1f2b6a3567513d5ebb97e5eed006b8282a86"),
+	TargetBits:             10,
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 210000,
+
+	PubKeyHashAddrID: 0x6f,
+	Secp256k1AddrID:  0x7f,
+	SchnorrAddrID:    0x81,
+	ScriptHashAddrID: 0xc4,
+	MultisigAddrID:   0x34,
+	Bech32HRP:        "tspc",
+	PrivateKeyID:     0xef,
+	//扩展私钥以tsrv开头，扩展公钥以tsub开头
+	HDPrivateKeyID: []byte{0x04, 0x36, 0x96, 0xe4},
+	HDPublicKeyID:  []byte{0x04, 0x36, 0x9b, 0x1e},
+	//与BIP44的约定相同，测试网络都使用币种1
+	HDCoinType: 1,
+}
+
+//回归测试网，用于本地测试：不需要工作量证明，可以立即出块，挖矿奖励减半的间隔很短
+var regTestParams = ChainParams{
+	Name:        "regtest",
+	Magic:       [4]byte{0xfb, 0x73, 0x72, 0x74},
+	DefaultPort: "23000",
+	Seeds:       []string{"localhost:23000"},
+	DataDir:     "regtest",
+
+	GenesisPrevBlockHash:   make([]byte, 32),
+	GenesisTimestamp:       1672531202,
+	GenesisHash:            hexToBytes("d00ec5a3d4bb11cbcedac7abecf7f6a17b073b58cc92766bb2b826bb4f4a4b81"),
+	TargetBits:             0,
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 150,
+
+	PubKeyHashAddrID: 0x6f,
+	Secp256k1AddrID:  0x7f,
+	SchnorrAddrID:    0x81,
+	ScriptHashAddrID: 0xc4,
+	MultisigAddrID:   0x34,
+	Bech32HRP:        "sprt",
+	PrivateKeyID:     0xef,
+	//扩展私钥以tsrv开头，扩展公钥以tsub开头
+	HDPrivateKeyID: []byte{0x04, 0x36, 0x96, 0xe4},
+	HDPublicKeyID:  []byte{0x04, 0x36, 0x9b, 0x1e},
+	//与BIP44的约定相同，测试网络都使用币种1
+	HDCoinType: 1,
+}
+
+//所有内置的网络
+var chainParamsList = []*ChainParams{&mainNetParams, &testNetParams, &regTestParams}
+
+//当前使用的网络，默认为主网
+var activeNetParams = &mainNetParams
+
+//将网络参数中的十六进制字符串转换为字节数组
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		log.Panic(err)
+	}
+	return b
+}
+
+//根据名称选择当前使用的网络
+func SelectNetwork(name string) error {
+	for _, params := range chainParamsList {
+		if params.Name == name {
+			activeNetParams = params
+			return nil
+		}
+	}
+	return errors.New("不支持的网络" + name + "，可选的网络为mainnet、testnet、regtest")
+}
+
+//返回节点的NODE_ID，由配置文件或NODE_ID环境变量设置，都没有设置时使用当前网络的默认端口
+func getNodeId() string {
+	return firstNonEmpty(cfg.Node.NodeId, os.Getenv(envNodeId), activeNetParams.DefaultPort)
+}
+
+//返回指定高度的区块的挖矿奖励（不含手续费）
+func (params *ChainParams) subsidy(height int64) float64 {
+	if params.SubsidyHalvingInterval == 0 {
+		return params.BaseSubsidy
+	}
+	halvings := height / params.SubsidyHalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return params.BaseSubsidy / float64(uint64(1)<<uint(halvings))
+}
+
+//返回当前网络的数据文件名，format中的%s为节点的NODE_ID，数据文件位于数据目录中，目录不存在时创建目录
+func dataFileName(format, nodeId string) string {
+	dir := filepath.Join(cfg.DataDir, activeNetParams.DataDir)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Panic(err)
+	}
+	return filepath.Join(dir, fmt.Sprintf(format, nodeId))
+}
@@ -0,0 +1,123 @@
+package blc
+
+import (
+	"encoding/json"
+)
+
+//区块链的存储：区块链和UTXO池只通过ChainStore读写数据，不直接依赖具体的数据库
+//存储后端只需要实现按表读写键值对的事务（storeBackendTx），区块、最新区块的哈希值、区块高度索引和UTXO的读写由StoreTx在此基础上实现
+//目前有两种存储后端：保存到文件中的BoltDB和只保存在内存中的memoryStore（用于测试，不需要磁盘上的文件）
+
+//区块链的存储
+type ChainStore interface {
+	//在只读事务中执行fn
+	View(fn func(tx *StoreTx) error) error
+	//在读写事务中执行fn，fn返回错误时放弃所有修改，否则原子地提交所有修改
+	Update(fn func(tx *StoreTx) error) error
+	//关闭存储
+	Close() error
+}
+
+//存储后端的事务，按表读写键值对，表在第一次写入时创建
+type storeBackendTx interface {
+	//读取键对应的值，表或键不存在时返回nil
+	get(table string, key []byte) []byte
+	//写入键值对
+	put(table string, key, value []byte) error
+	//删除键值对
+	delete(table string, key []byte) error
+	//按键的字节顺序遍历表中的键值对，表不存在时不调用fn
+	forEach(table string, fn func(key, value []byte) error) error
+	//按键的字节顺序遍历表中以prefix开头的键值对
+	forEachPrefix(table string, prefix []byte, fn func(key, value []byte) error) error
+	//删除整个表
+	deleteTable(table string) error
+}
+
+//存储的事务
+type StoreTx struct {
+	backend storeBackendTx
+}
+
+//读取区块，区块不存在时返回nil
+func (tx *StoreTx) Block(hash []byte) *Block {
+	return Deserialize(tx.BlockBytes(hash))
+}
+
+//读取区块序列化后的字节数组，区块不存在时返回nil
+func (tx *StoreTx) BlockBytes(hash []byte) []byte {
+	return tx.backend.get(tableName, hash)
+}
+
+//保存区块
+func (tx *StoreTx) PutBlock(b *Block) error {
+	return tx.backend.put(tableName, b.Hash, b.Serialize())
+}
+
+//最新的区块的哈希值，区块链不存在时返回nil，修改最新的区块见SetTip
+func (tx *StoreTx) Tip() []byte {
+	return tx.backend.get(tableName, []byte(lastHashKey))
+}
+
+//读取交易在UTXO池中的未花费输出
+func (tx *StoreTx) UTXOs(txHash []byte) []UTXO {
+	var utxos []UTXO
+	json.Unmarshal(tx.backend.get(utxoTableName, txHash), &utxos)
+	return utxos
+}
+
+//保存交易在UTXO池中的未花费输出
+func (tx *StoreTx) PutUTXOs(txHash []byte, utxos []UTXO) error {
+	utxosBytes, err := json.Marshal(utxos)
+	if err != nil {
+		return err
+	}
+	return tx.backend.put(utxoTableName, txHash, utxosBytes)
+}
+
+//遍历UTXO池中每个交易的未花费输出
+func (tx *StoreTx) ForEachUTXOs(fn func(txHash []byte, utxos []UTXO) error) error {
+	return tx.backend.forEach(utxoTableName, func(key, value []byte) error {
+		var utxos []UTXO
+		err := json.Unmarshal(value, &utxos)
+		if err != nil {
+			return err
+		}
+		return fn(key, utxos)
+	})
+}
+
+//清空UTXO池
+func (tx *StoreTx) ClearUTXOs() error {
+	return tx.backend.deleteTable(utxoTableName)
+}
+
+//读取其他表（例如钱包账本和索引）中的值，表或键不存在时返回nil
+func (tx *StoreTx) Get(table string, key []byte) []byte {
+	return tx.backend.get(table, key)
+}
+
+//向其他表中写入键值对
+func (tx *StoreTx) Put(table string, key, value []byte) error {
+	return tx.backend.put(table, key, value)
+}
+
+//删除其他表中的键值对
+func (tx *StoreTx) Delete(table string, key []byte) error {
+	return tx.backend.delete(table, key)
+}
+
+//按键的字节顺序遍历其他表中的键值对
+func (tx *StoreTx) ForEach(table string, fn func(key, value []byte) error) error {
+	return tx.backend.forEach(table, fn)
+}
+
+//按键的字节顺序遍历其他表中以prefix开头的键值对
+func (tx *StoreTx) ForEachPrefix(table string, prefix []byte, fn func(key, value []byte) error) error {
+	return tx.backend.forEachPrefix(table, prefix, fn)
+}
+
+//删除其他表
+func (tx *StoreTx) DeleteTable(table string) error {
+	return tx.backend.deleteTable(table)
+}
@@ -0,0 +1,245 @@
+package blc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+//UTXO池中每个交易的未花费输出序号，key为交易哈希的十六进制字符串
+func utxoVouts(t *testing.T, bc *blockChain) map[string][]int64 {
+	t.Helper()
+	vouts := make(map[string][]int64)
+	err := bc.Store.View(func(tx *StoreTx) error {
+		return tx.ForEachUTXOs(func(txHash []byte, utxos []UTXO) error {
+			for _, utxo := range utxos {
+				vouts[hex.EncodeToString(txHash)] = append(vouts[hex.EncodeToString(txHash)], utxo.Vout)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vouts
+}
+
+//UTXO池必须与遍历区块链找出的未花费输出一致
+func checkUTXOSet(t *testing.T, bc *blockChain) {
+	t.Helper()
+	walked := make(map[string][]int64)
+	for txHash, utxos := range bc.FindUTXOs() {
+		for _, utxo := range utxos {
+			walked[txHash] = append(walked[txHash], utxo.Vout)
+		}
+		sort.Slice(walked[txHash], func(i, j int) bool { return walked[txHash][i] < walked[txHash][j] })
+	}
+	if stored := utxoVouts(t, bc); !reflect.DeepEqual(stored, walked) {
+		t.Fatalf("UTXO池%v与区块链%v不一致", stored, walked)
+	}
+}
+
+//将区块链的最新区块设为b
+func setTestTip(t *testing.T, bc *blockChain, b *Block) {
+	t.Helper()
+	err := bc.Store.Update(func(tx *StoreTx) error {
+		return tx.SetTip(b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Tip = b.Hash
+}
+
+func TestCreateBlockChainInStore(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	bc := newTestChain(t, miner)
+	//创世块由网络参数确定，其后的第一个区块的挖矿奖励发给miner
+	if bc.GetBestHeight() != 1 {
+		t.Fatalf("第一个区块的高度为%d", bc.GetBestHeight())
+	}
+	if err := bc.checkGenesisBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bc.GetBalance(string(miner.GetAddress())); balance != activeNetParams.BaseSubsidy {
+		t.Fatalf("第一个区块的挖矿奖励为%f，应为%f", balance, activeNetParams.BaseSubsidy)
+	}
+	checkUTXOSet(t, bc)
+	//同一个存储中再次打开区块链，不能重复创建
+	reopened := getBlockChainFromStore(bc.Store)
+	if !bytes.Equal(reopened.Tip, bc.Tip) {
+		t.Fatal("重新打开后最新区块不一致")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("重复创建区块链没有失败")
+			}
+		}()
+		createBlockChainInStore(bc.Store, string(miner.GetAddress()))
+	}()
+}
+
+func TestStoreUTXOOperations(t *testing.T) {
+	store := NewMemoryStore()
+	output := &TxOutput{Value: 1, Ripemd160Hash: make([]byte, 20)}
+	err := store.Update(func(tx *StoreTx) error {
+		if err := tx.PutUTXOs([]byte{2}, []UTXO{{output, 0}, {output, 3}}); err != nil {
+			return err
+		}
+		return tx.PutUTXOs([]byte{1}, []UTXO{{output, 1}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//事务返回错误时放弃所有修改
+	err = store.Update(func(tx *StoreTx) error {
+		if err := tx.ClearUTXOs(); err != nil {
+			return err
+		}
+		return errors.New("放弃修改")
+	})
+	if err == nil {
+		t.Fatal("事务的错误没有返回")
+	}
+	err = store.View(func(tx *StoreTx) error {
+		if utxos := tx.UTXOs([]byte{2}); len(utxos) != 2 || utxos[1].Vout != 3 || utxos[1].Output.Value != 1 {
+			t.Fatalf("读取的UTXO错误：%v", utxos)
+		}
+		var keys [][]byte
+		err := tx.ForEachUTXOs(func(txHash []byte, utxos []UTXO) error {
+			keys = append(keys, txHash)
+			return nil
+		})
+		if !reflect.DeepEqual(keys, [][]byte{{1}, {2}}) {
+			t.Fatalf("遍历顺序错误：%v", keys)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Update(func(tx *StoreTx) error {
+		return tx.ClearUTXOs()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.View(func(tx *StoreTx) error {
+		if tx.UTXOs([]byte{1}) != nil {
+			t.Fatal("清空后UTXO池不为空")
+		}
+		return nil
+	})
+}
+
+//切换到其他分叉时，UTXO池随区块的断开和连接而更新
+func TestSetTipReorganizesUTXOSet(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	bob := newTestWallet(t, 2, KeyTypeSecp256k1)
+	bobAddr := string(bob.GetAddress())
+	bc := newTestChain(t, miner)
+	first := bc.Iterator().Next()
+	tx := newTestTransaction(t, bc, miner, map[string]float64{bobAddr: 3}, TxOptions{})
+	if err := bc.AddBlock(string(miner.GetAddress()), []*transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlocks(t, bc, miner, 1)
+	mainTip := bc.Iterator().Next()
+	checkUTXOSet(t, bc)
+
+	//从第一个区块开始的更长的分叉，其中没有给bob的交易
+	carol := string(newTestWallet(t, 3, KeyTypeP256).GetAddress())
+	prev := first
+	for height := int64(2); height <= 4; height++ {
+		b := NewBlock(height, prev.Hash, []*transaction{newCoinbaseTransactionWithFees(carol, height, 0)})
+		err := bc.Store.Update(func(tx *StoreTx) error {
+			return tx.PutBlock(b)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = b
+	}
+	setTestTip(t, bc, prev)
+	checkUTXOSet(t, bc)
+	if balance := bc.GetBalance(bobAddr); balance != 0 {
+		t.Fatalf("切换分叉后bob的余额为%f，应为0", balance)
+	}
+	if balance := bc.GetBalance(carol); balance != 3*activeNetParams.BaseSubsidy {
+		t.Fatalf("切换分叉后carol的余额为%f", balance)
+	}
+
+	//切换回原来的分叉，bob收到的输出恢复
+	setTestTip(t, bc, mainTip)
+	checkUTXOSet(t, bc)
+	if balance := bc.GetBalance(bobAddr); balance != 3 {
+		t.Fatalf("切换回原来的分叉后bob的余额为%f，应为3", balance)
+	}
+}
+
+//区块中花费了不存在的输出时，区块、最新区块和UTXO池都不变
+func TestMineBlockIsAtomic(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	to := string(newTestWallet(t, 2, KeyTypeP256).GetAddress())
+	bc := newTestChain(t, miner)
+	first := newTestTransaction(t, bc, miner, map[string]float64{to: 1}, TxOptions{})
+	second := newTestTransaction(t, bc, miner, map[string]float64{to: 2}, TxOptions{})
+	tip := bc.Tip
+	before := utxoVouts(t, bc)
+	if _, err := bc.mineBlock(string(miner.GetAddress()), []*transaction{first, second}); err == nil {
+		t.Fatal("重复花费同一个输出的区块被接受")
+	}
+	if !bytes.Equal(bc.Tip, tip) || bc.GetBestHeight() != 1 {
+		t.Fatal("失败后最新区块被修改")
+	}
+	if after := utxoVouts(t, bc); !reflect.DeepEqual(before, after) {
+		t.Fatal("失败后UTXO池被修改")
+	}
+	b, err := bc.mineBlock(string(miner.GetAddress()), []*transaction{first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.Tip, b.Hash) {
+		t.Fatal("最新区块没有更新")
+	}
+	checkUTXOSet(t, bc)
+}
+
+//旧版本的数据库中没有UTXO池的回滚数据，打开时重建
+func TestGetBlockChainRebuildsLegacyUTXOSet(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	bc := newTestChain(t, miner)
+	mineTestBlocks(t, bc, miner, 2)
+	err := bc.Store.Update(func(tx *StoreTx) error {
+		if err := tx.DeleteTable(utxoUndoTableName); err != nil {
+			return err
+		}
+		return tx.Delete(indexStateTableName, []byte(utxoUndoTableName))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc = getBlockChainFromStore(bc.Store)
+	checkUTXOSet(t, bc)
+	//重建后可以断开区块
+	setTestTip(t, bc, prevTestBlock(t, bc, bc.Iterator().Next()))
+	checkUTXOSet(t, bc)
+}
+
+//区块的前一个区块
+func prevTestBlock(t *testing.T, bc *blockChain, b *Block) *Block {
+	t.Helper()
+	var prev *Block
+	bc.Store.View(func(tx *StoreTx) error {
+		prev = tx.Block(b.PrevBlockHash)
+		return nil
+	})
+	if prev == nil {
+		t.Fatal("前一个区块不存在")
+	}
+	return prev
+}
@@ -0,0 +1,286 @@
+package blc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//选币：从地址的所有UTXO中选出用于当前交易的输入，并计算手续费和找零
+//金额在选币时转换为整数单位进行计算，避免浮点数误差，相同的UTXO集合总是得到相同的结果
+
+//选币策略
+const (
+	//优先使用金额最大的UTXO，输入数量最少
+	CoinSelectLargestFirst = "largest"
+	//优先使用金额最小的UTXO，可以合并零碎的UTXO
+	CoinSelectSmallestFirst = "smallest"
+	//分支定界：寻找不需要找零的UTXO组合，找不到时使用largest策略
+	CoinSelectBranchAndBound = "bnb"
+)
+
+//金额的最小单位，1个币 = coinUnits个最小单位
+const coinUnits = 100000000
+
+//估算交易大小时使用的字节数：交易的固定部分、每个输入（交易哈希、索引、签名、公钥）、每个输出
+const estimatedTxBaseSize = 16
+const estimatedInputSize = 180
+const estimatedOutputSize = 40
+
+//小于该金额（最小单位）的找零直接作为手续费
+const dustThreshold = 1000
+
+//分支定界搜索的最大尝试次数
+const bnbMaxTries = 100000
+
+//UTXO在区块链中的位置
+type OutPoint struct {
+	TxHash []byte
+	Vout   int64
+}
+
+//地址的一个UTXO
+type addressUTXO struct {
+	OutPoint
+	Output *TxOutput
+}
+
+//选币结果
+type coinSelection struct {
+	//选中的UTXO
+	UTXOs []*addressUTXO
+	//选中的UTXO的总金额
+	Total float64
+	//手续费
+	Fee float64
+	//找零金额，为0时不需要找零
+	Change float64
+}
+
+//将金额转换为最小单位
+func toCoinUnits(amount float64) int64 {
+	return int64(math.Round(amount * coinUnits))
+}
+
+//将最小单位转换为金额
+func fromCoinUnits(units int64) float64 {
+	return float64(units) / coinUnits
+}
+
+//估算交易的手续费，feeRate为每字节的手续费（最小单位）
+func estimateFee(feeRate int64, inputs, outputs int) int64 {
+	return feeRate * int64(estimatedTxBaseSize+inputs*estimatedInputSize+outputs*estimatedOutputSize)
+}
+
+//解析txid:vout形式的UTXO列表，以逗号分隔
+func ParseOutPoints(param string) ([]OutPoint, error) {
+	var outPoints []OutPoint
+	for _, item := range strings.Split(param, ",") {
+		arr := strings.Split(strings.TrimSpace(item), ":")
+		if len(arr) != 2 {
+			return nil, errors.New("输入" + item + "的格式错误，应为txid:vout")
+		}
+		txHash, err := hex.DecodeString(arr[0])
+		if err != nil {
+			return nil, errors.New("输入" + item + "的交易哈希无效")
+		}
+		vout, err := strconv.ParseInt(arr[1], 10, 64)
+		if err != nil || vout < 0 {
+			return nil, errors.New("输入" + item + "的索引无效")
+		}
+		outPoints = append(outPoints, OutPoint{txHash, vout})
+	}
+	return outPoints, nil
+}
+
+//为地址选出足够支付amount和手续费的UTXO，outputs为不含找零的输出数量
+func selectCoins(utxos []*addressUTXO, amount float64, outputs int, opts TxOptions) (*coinSelection, error) {
+	target := toCoinUnits(amount)
+	feeRate := toCoinUnits(opts.FeeRate)
+	if target <= 0 {
+		return nil, errors.New("转账金额必须大于0")
+	}
+	if feeRate < 0 {
+		return nil, errors.New("手续费率不能小于0")
+	}
+	//排序后结果与UTXO池中的存储顺序无关
+	sort.Slice(utxos, func(i, j int) bool {
+		if c := bytes.Compare(utxos[i].TxHash, utxos[j].TxHash); c != 0 {
+			return c < 0
+		}
+		return utxos[i].Vout < utxos[j].Vout
+	})
+	var selected []*addressUTXO
+	var err error
+	switch {
+	case opts.Inputs != nil:
+		selected, err = selectOutPoints(utxos, opts.Inputs)
+	case opts.Strategy == CoinSelectLargestFirst:
+		selected = selectInOrder(utxos, target, feeRate, outputs, false)
+	case opts.Strategy == CoinSelectSmallestFirst:
+		selected = selectInOrder(utxos, target, feeRate, outputs, true)
+	case opts.Strategy == CoinSelectBranchAndBound || opts.Strategy == "":
+		selected = selectBranchAndBound(utxos, target, feeRate, outputs)
+		if selected == nil {
+			selected = selectInOrder(utxos, target, feeRate, outputs, false)
+		}
+	default:
+		return nil, errors.New("选币策略" + opts.Strategy + "无效")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newCoinSelection(selected, target, feeRate, outputs)
+}
+
+//计算选中UTXO后的手续费和找零，金额不足时返回错误
+func newCoinSelection(selected []*addressUTXO, target, feeRate int64, outputs int) (*coinSelection, error) {
+	var total int64
+	for _, utxo := range selected {
+		total += toCoinUnits(utxo.Output.Value)
+	}
+	fee := estimateFee(feeRate, len(selected), outputs)
+	if total < target+fee {
+		return nil, fmt.Errorf("余额不足，需要%f（含手续费%f），可用%f", fromCoinUnits(target+fee), fromCoinUnits(fee), fromCoinUnits(total))
+	}
+	//找零需要增加一个输出，找零过少时不找零，剩余金额作为手续费
+	change := total - target - estimateFee(feeRate, len(selected), outputs+1)
+	if change < dustThreshold {
+		change = 0
+		fee = total - target
+	} else {
+		fee = total - target - change
+	}
+	return &coinSelection{selected, fromCoinUnits(total), fromCoinUnits(fee), fromCoinUnits(change)}, nil
+}
+
+//按照金额从大到小（或从小到大）依次选择UTXO，直到足够支付金额和手续费
+func selectInOrder(utxos []*addressUTXO, target, feeRate int64, outputs int, ascending bool) []*addressUTXO {
+	sorted := make([]*addressUTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ascending {
+			return sorted[i].Output.Value < sorted[j].Output.Value
+		}
+		return sorted[i].Output.Value > sorted[j].Output.Value
+	})
+	var selected []*addressUTXO
+	var total int64
+	for _, utxo := range sorted {
+		selected = append(selected, utxo)
+		total += toCoinUnits(utxo.Output.Value)
+		if total >= target+estimateFee(feeRate, len(selected), outputs) {
+			break
+		}
+	}
+	return selected
+}
+
+//分支定界：按照有效金额（金额减去花费该UTXO的手续费）从大到小进行深度优先搜索，
+//寻找总有效金额在[目标金额, 目标金额+找零成本]之间的组合，这样的组合不需要找零
+func selectBranchAndBound(utxos []*addressUTXO, target, feeRate int64, outputs int) []*addressUTXO {
+	type candidate struct {
+		utxo  *addressUTXO
+		value int64
+	}
+	var candidates []candidate
+	var available int64
+	for _, utxo := range utxos {
+		value := toCoinUnits(utxo.Output.Value) - feeRate*estimatedInputSize
+		//有效金额不大于0的UTXO花费的手续费比自身金额还多
+		if value > 0 {
+			candidates = append(candidates, candidate{utxo, value})
+			available += value
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].value > candidates[j].value })
+	//目标金额包含交易固定部分和所有输出的手续费
+	target += estimateFee(feeRate, 0, outputs)
+	costOfChange := feeRate*estimatedOutputSize + dustThreshold
+	if available < target {
+		return nil
+	}
+
+	var best []bool
+	bestWaste := int64(-1)
+	current := make([]bool, len(candidates))
+	var currentValue int64
+	remaining := available
+	depth := 0
+	for tries := 0; tries < bnbMaxTries; tries++ {
+		backtrack := false
+		if currentValue+remaining < target || currentValue > target+costOfChange {
+			backtrack = true
+		} else if currentValue >= target {
+			//超出目标的部分作为手续费浪费掉了，选择浪费最少的组合
+			if waste := currentValue - target; bestWaste < 0 || waste < bestWaste {
+				best = append([]bool{}, current[:depth]...)
+				bestWaste = waste
+				if waste == 0 {
+					break
+				}
+			}
+			backtrack = true
+		} else if depth == len(candidates) {
+			backtrack = true
+		}
+		if backtrack {
+			//回溯到最近一个被选中的UTXO，改为不选它
+			for depth > 0 && !current[depth-1] {
+				depth--
+				remaining += candidates[depth].value
+			}
+			if depth == 0 {
+				break
+			}
+			current[depth-1] = false
+			currentValue -= candidates[depth-1].value
+			continue
+		}
+		//选中当前UTXO，继续搜索下一层
+		current[depth] = true
+		currentValue += candidates[depth].value
+		remaining -= candidates[depth].value
+		depth++
+	}
+	if best == nil {
+		return nil
+	}
+	var selected []*addressUTXO
+	for i, chosen := range best {
+		if chosen {
+			selected = append(selected, candidates[i].utxo)
+		}
+	}
+	return selected
+}
+
+//使用指定的UTXO，每个UTXO都必须属于该地址且未被花费
+func selectOutPoints(utxos []*addressUTXO, outPoints []OutPoint) ([]*addressUTXO, error) {
+	var selected []*addressUTXO
+	used := make(map[string]bool)
+	for _, outPoint := range outPoints {
+		key := fmt.Sprintf("%x:%d", outPoint.TxHash, outPoint.Vout)
+		if used[key] {
+			return nil, errors.New("输入" + key + "重复")
+		}
+		used[key] = true
+		var found *addressUTXO
+		for _, utxo := range utxos {
+			if bytes.Equal(utxo.TxHash, outPoint.TxHash) && utxo.Vout == outPoint.Vout {
+				found = utxo
+				break
+			}
+		}
+		if found == nil {
+			return nil, errors.New("输入" + key + "不存在、已被花费或不属于汇款人地址")
+		}
+		selected = append(selected, found)
+	}
+	return selected, nil
+}
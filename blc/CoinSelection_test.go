@@ -0,0 +1,127 @@
+package blc
+
+import (
+	"strings"
+	"testing"
+)
+
+//金额分别为1、2、5、10的UTXO，交易哈希依次为01、02、03、04
+func testCoins() []*addressUTXO {
+	var utxos []*addressUTXO
+	for i, value := range []float64{1, 2, 5, 10} {
+		utxos = append(utxos, &addressUTXO{OutPoint{[]byte{byte(i + 1)}, 0}, &TxOutput{Value: value}})
+	}
+	return utxos
+}
+
+//选中的UTXO的金额
+func selectedValues(selection *coinSelection) []float64 {
+	var values []float64
+	for _, utxo := range selection.UTXOs {
+		values = append(values, utxo.Output.Value)
+	}
+	return values
+}
+
+func TestSelectCoins(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		opts     TxOptions
+		selected []float64
+		fee      float64
+		change   float64
+	}{
+		{"largest", 6, TxOptions{Strategy: CoinSelectLargestFirst}, []float64{10}, 0, 4},
+		{"smallest", 6, TxOptions{Strategy: CoinSelectSmallestFirst}, []float64{1, 2, 5}, 0, 2},
+		//5+2正好等于转账金额，不需要找零
+		{"bnb exact", 7, TxOptions{Strategy: CoinSelectBranchAndBound}, []float64{5, 2}, 0, 0},
+		{"bnb is default", 7, TxOptions{}, []float64{5, 2}, 0, 0},
+		//没有不需要找零的组合，使用largest策略
+		{"bnb fallback", 9.5, TxOptions{}, []float64{10}, 0, 0.5},
+		//手续费：16 + 2*180 + 2*40 = 456个最小单位，10不够支付手续费，需要再选一个UTXO
+		{"largest with fee", 10, TxOptions{Strategy: CoinSelectLargestFirst, FeeRate: fromCoinUnits(1)}, []float64{10, 5}, fromCoinUnits(456), 5 - fromCoinUnits(456)},
+		//5和2的有效金额（减去输入的手续费180）之和正好等于转账金额加上固定部分和一个输出的手续费56
+		{"bnb with fee", fromCoinUnits(7*coinUnits - 416), TxOptions{FeeRate: fromCoinUnits(1)}, []float64{5, 2}, fromCoinUnits(416), 0},
+		//找零小于dustThreshold时不找零，作为手续费
+		{"dust change", fromCoinUnits(10*coinUnits - 500), TxOptions{Strategy: CoinSelectLargestFirst}, []float64{10}, fromCoinUnits(500), 0},
+		{"explicit inputs", 2, TxOptions{Inputs: []OutPoint{{[]byte{4}, 0}, {[]byte{1}, 0}}}, []float64{10, 1}, 0, 9},
+	}
+	for _, test := range tests {
+		selection, err := selectCoins(testCoins(), test.amount, 1, test.opts)
+		if err != nil {
+			t.Errorf("%s：%v", test.name, err)
+			continue
+		}
+		values := selectedValues(selection)
+		if len(values) != len(test.selected) {
+			t.Errorf("%s：选中了%v，应为%v", test.name, values, test.selected)
+			continue
+		}
+		for i := range values {
+			if values[i] != test.selected[i] {
+				t.Errorf("%s：选中了%v，应为%v", test.name, values, test.selected)
+				break
+			}
+		}
+		if toCoinUnits(selection.Fee) != toCoinUnits(test.fee) || toCoinUnits(selection.Change) != toCoinUnits(test.change) {
+			t.Errorf("%s：手续费为%f，找零为%f，应为%f和%f", test.name, selection.Fee, selection.Change, test.fee, test.change)
+		}
+		//输入总额等于转账金额、手续费与找零之和
+		if toCoinUnits(selection.Total) != toCoinUnits(test.amount)+toCoinUnits(selection.Fee)+toCoinUnits(selection.Change) {
+			t.Errorf("%s：输入总额%f与输出不一致", test.name, selection.Total)
+		}
+	}
+}
+
+//UTXO的顺序不影响选币结果
+func TestSelectCoinsIsDeterministic(t *testing.T) {
+	for _, strategy := range []string{CoinSelectLargestFirst, CoinSelectSmallestFirst, CoinSelectBranchAndBound} {
+		coins := testCoins()
+		want, err := selectCoins(coins, 7, 1, TxOptions{Strategy: strategy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reversed := testCoins()
+		for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+			reversed[i], reversed[j] = reversed[j], reversed[i]
+		}
+		got, err := selectCoins(reversed, 7, 1, TxOptions{Strategy: strategy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantValues, gotValues := selectedValues(want), selectedValues(got)
+		if len(wantValues) != len(gotValues) {
+			t.Fatalf("%s：UTXO顺序不同时选中了%v和%v", strategy, wantValues, gotValues)
+		}
+		for i := range wantValues {
+			if wantValues[i] != gotValues[i] {
+				t.Fatalf("%s：UTXO顺序不同时选中了%v和%v", strategy, wantValues, gotValues)
+			}
+		}
+	}
+}
+
+func TestSelectCoinsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount float64
+		opts   TxOptions
+		err    string
+	}{
+		{"insufficient", 19, TxOptions{}, "余额不足"},
+		{"insufficient for fee", 18, TxOptions{FeeRate: fromCoinUnits(1)}, "余额不足"},
+		{"zero amount", 0, TxOptions{}, "转账金额必须大于0"},
+		{"negative fee rate", 1, TxOptions{FeeRate: -1}, "手续费率不能小于0"},
+		{"unknown strategy", 1, TxOptions{Strategy: "random"}, "选币策略random无效"},
+		{"duplicate input", 1, TxOptions{Inputs: []OutPoint{{[]byte{1}, 0}, {[]byte{1}, 0}}}, "重复"},
+		{"missing input", 1, TxOptions{Inputs: []OutPoint{{[]byte{1}, 1}}}, "不存在"},
+		{"inputs not enough", 5, TxOptions{Inputs: []OutPoint{{[]byte{1}, 0}}}, "余额不足"},
+	}
+	for _, test := range tests {
+		_, err := selectCoins(testCoins(), test.amount, 1, test.opts)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s：错误为%v，应包含%s", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package blc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//节点配置：可以来自配置文件、环境变量和命令行参数，优先级从低到高为：默认值、配置文件、环境变量、命令行参数
+//配置文件为TOML格式，默认为数据目录中的spc.toml，也可以用--config参数或SPC_CONFIG环境变量指定，例如：
+//
+//	network = "regtest"
+//	datacarriersize = 80
+//	txindex = true
+//	addrindex = true
+//	dataindex = true
+//
+//	[node]
+//	nodeid = "3000"
+//	listen = "0.0.0.0:3000"
+//	externaladdr = "192.168.1.10:3000"
+//	seeds = ["192.168.1.2:3000"]
+//	miner = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+//
+//	[log]
+//	file = "debug.log"
+
+//默认的配置文件名
+const defaultConfigFileName = "spc.toml"
+
+//配置相关的环境变量
+const (
+	envNodeId  = "NODE_ID"
+	envConfig  = "SPC_CONFIG"
+	envDataDir = "SPC_DATADIR"
+	envNetwork = "SPC_NETWORK"
+	envMiner   = "SPC_MINER"
+)
+
+//节点配置
+type Config struct {
+	//数据目录，区块链数据库和钱包文件都保存在该目录中，主网以外的网络使用其中以网络名称命名的子目录
+	DataDir string `toml:"datadir"`
+	//网络名称：mainnet、testnet或regtest
+	Network string `toml:"network"`
+	//数据输出中最多可以携带的字节数
+	DataCarrierSize int `toml:"datacarriersize"`
+	//是否启用交易索引，启用后按交易哈希查找交易不需要遍历区块链，启用前已有的区块需要用reindex命令建立索引
+	TxIndex bool `toml:"txindex"`
+	//是否启用地址索引，启用后可以查询任何地址的交易历史，查询余额和UTXO不需要遍历UTXO池，启用前已有的区块需要用reindex命令建立索引
+	AddrIndex bool `toml:"addrindex"`
+	//是否启用数据索引，启用后findData不需要遍历区块链，启用前已有的区块需要用reindex命令建立索引
+	DataIndex bool       `toml:"dataindex"`
+	Node      NodeConfig `toml:"node"`
+	Log       LogConfig  `toml:"log"`
+}
+
+//节点服务器的配置
+type NodeConfig struct {
+	//节点编号，也是数据文件名的后缀和默认的端口
+	NodeId string `toml:"nodeid"`
+	//监听地址，默认为localhost:<NodeId>
+	Listen string `toml:"listen"`
+	//向其他节点公布的地址，其他节点通过该地址连接当前节点，默认与监听地址相同
+	ExternalAddr string `toml:"externaladdr"`
+	//种子节点，第一个为主节点，为空时使用当前网络的种子节点
+	Seeds []string `toml:"seeds"`
+	//挖矿奖励的地址，startNode没有指定--miner时使用
+	Miner string `toml:"miner"`
+}
+
+//日志的配置
+type LogConfig struct {
+	//日志文件，相对路径时位于数据目录中，为空时只输出到标准错误
+	File string `toml:"file"`
+}
+
+//当前使用的配置
+var cfg = defaultConfig()
+
+//默认配置
+func defaultConfig() *Config {
+	return &Config{
+		DataDir:         ".",
+		Network:         mainNetParams.Name,
+		DataCarrierSize: MaxDataCarrierSize,
+	}
+}
+
+//加载配置：先读取配置文件，再依次用环境变量和命令行参数覆盖，然后应用配置
+//flags为命令行中的全局参数（config、datadir、network、datacarriersize），key为参数名
+func loadConfig(flags map[string]string) error {
+	c := defaultConfig()
+	//确定配置文件的位置：--config > SPC_CONFIG > 数据目录中的spc.toml
+	dataDir := firstNonEmpty(flags["datadir"], os.Getenv(envDataDir))
+	configFile := firstNonEmpty(flags["config"], os.Getenv(envConfig))
+	explicit := configFile != ""
+	if !explicit {
+		configFile = filepath.Join(firstNonEmpty(dataDir, c.DataDir), defaultConfigFileName)
+	}
+	if _, err := os.Stat(configFile); err == nil {
+		meta, err := toml.DecodeFile(configFile, c)
+		if err != nil {
+			return errors.New("配置文件" + configFile + "格式错误：" + err.Error())
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return errors.New("配置文件" + configFile + "中有未知的配置项" + undecoded[0].String())
+		}
+	} else if explicit {
+		return errors.New("配置文件" + configFile + "不存在")
+	}
+	//环境变量覆盖配置文件
+	overrideString(&c.DataDir, os.Getenv(envDataDir))
+	overrideString(&c.Network, os.Getenv(envNetwork))
+	overrideString(&c.Node.NodeId, os.Getenv(envNodeId))
+	overrideString(&c.Node.Miner, os.Getenv(envMiner))
+	//命令行参数覆盖环境变量
+	overrideString(&c.DataDir, flags["datadir"])
+	overrideString(&c.Network, flags["network"])
+	if size := flags["datacarriersize"]; size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return errors.New("--datacarriersize参数必须是整数")
+		}
+		c.DataCarrierSize = n
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+	cfg = c
+	return nil
+}
+
+//校验并应用配置
+func (c *Config) apply() error {
+	if err := SelectNetwork(c.Network); err != nil {
+		return err
+	}
+	if c.Node.NodeId == "" {
+		c.Node.NodeId = activeNetParams.DefaultPort
+	}
+	if c.DataCarrierSize <= 0 || c.DataCarrierSize > MaxConsensusDataCarrierSize {
+		return fmt.Errorf("datacarriersize必须大于0且不能超过%d", MaxConsensusDataCarrierSize)
+	}
+	MaxDataCarrierSize = c.DataCarrierSize
+	if c.Log.File != "" {
+		logFile := c.Log.File
+		if !filepath.IsAbs(logFile) {
+			logFile = filepath.Join(c.DataDir, logFile)
+		}
+		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(io.MultiWriter(os.Stderr, file))
+	}
+	return nil
+}
+
+//节点的监听地址
+func (c *Config) listenAddr() string {
+	return firstNonEmpty(c.Node.Listen, "localhost:"+c.Node.NodeId)
+}
+
+//节点向其他节点公布的地址
+func (c *Config) externalAddr() string {
+	return firstNonEmpty(c.Node.ExternalAddr, c.listenAddr())
+}
+
+//种子节点
+func (c *Config) seeds() []string {
+	if len(c.Node.Seeds) > 0 {
+		return append([]string{}, c.Node.Seeds...)
+	}
+	return append([]string{}, activeNetParams.Seeds...)
+}
+
+//value不为空时覆盖target
+func overrideString(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
+
+//返回第一个不为空的字符串
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+//解析并去掉命令行中的全局参数，全局参数可以出现在命令之前或之后，例如：--network regtest createChain --address ADDRESS
+//switches中的参数没有值，出现时值为"true"
+func parseGlobalFlags(args []string, switches []string, names ...string) ([]string, map[string]string, error) {
+	flags := make(map[string]string)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if i == 0 || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		value := ""
+		hasValue := false
+		if index := strings.IndexByte(name, '='); index >= 0 {
+			name, value, hasValue = name[:index], name[index+1:], true
+		}
+		if containsString(switches, name) && !hasValue {
+			flags[name] = "true"
+			continue
+		}
+		if !containsString(names, name) {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, errors.New("--" + name + "参数缺少值")
+			}
+			i++
+			value = args[i]
+		}
+		flags[name] = value
+	}
+	return rest, flags, nil
+}
+
+//判断字符串切片中是否包含s
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
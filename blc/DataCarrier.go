@@ -0,0 +1,211 @@
+package blc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+)
+
+//共识规则中数据输出最多可以携带的字节数，所有节点校验区块时使用相同的限制
+const MaxConsensusDataCarrierSize = 80
+
+//本节点创建交易和打包区块时数据输出最多可以携带的字节数，属于本地策略，
+//可以在配置文件中用datacarriersize或命令行中用--datacarriersize修改，但不能超过共识规则中的限制
+var MaxDataCarrierSize = MaxConsensusDataCarrierSize
+
+//数据索引：记录最长链上每个数据输出所在的交易，FindData不需要遍历区块链
+//数据索引是可选的，在配置文件中设置dataindex = true时启用，启用前已有的区块需要用reindex命令建立索引
+//key为数据的SHA-256哈希，value为携带该数据的交易按区块高度排列的位置
+const dataIndexTableName = "dataindex"
+
+//创建携带数据的输出：OP_RETURN <数据>，该输出金额为0且不可花费
+func NewDataOutput(data []byte) (*TxOutput, error) {
+	if len(data) == 0 {
+		return nil, errors.New("数据输出中的数据不能为空")
+	}
+	if len(data) > MaxDataCarrierSize {
+		return nil, fmt.Errorf("数据输出最多只能携带%d字节的数据", MaxDataCarrierSize)
+	}
+	sb := &scriptBuilder{}
+	sb.addOp(OP_RETURN).addData(data)
+	return &TxOutput{Value: 0, ScriptPubKey: sb.Script()}, nil
+}
+
+//判断当前输出是否为不可花费的数据输出
+func (output *TxOutput) isUnspendable() bool {
+	return len(output.ScriptPubKey) > 0 && output.ScriptPubKey[0] == OP_RETURN
+}
+
+//取出数据输出中携带的数据
+func (output *TxOutput) carriedData() ([]byte, bool) {
+	if !output.isUnspendable() {
+		return nil, false
+	}
+	ops, err := parseScript(output.ScriptPubKey)
+	if err != nil || len(ops) != 2 || !ops[1].isPush() {
+		return nil, false
+	}
+	return ops[1].Data, true
+}
+
+//校验交易中的数据输出，每个数据输出最多携带maxSize字节的数据
+func (tx *transaction) checkDataOutputs(maxSize int) error {
+	for _, output := range tx.TxOutputs {
+		if !output.isUnspendable() {
+			continue
+		}
+		data, ok := output.carriedData()
+		if !ok {
+			return fmt.Errorf("交易%x中的数据输出格式错误", tx.TxHash)
+		}
+		if len(data) > maxSize || output.Value != 0 {
+			return fmt.Errorf("交易%x中的数据输出超过了%d字节或金额不为0", tx.TxHash, maxSize)
+		}
+	}
+	return nil
+}
+
+//数据在区块链中的位置
+type DataLocation struct {
+	//所在区块的高度
+	Height int64
+	//所在区块的哈希值
+	BlockHash []byte
+	//所在区块的时间戳
+	Timestamp int64
+	//所在交易的哈希值
+	TxHash []byte
+	//确认数
+	Confirmations int64
+}
+
+//数据在数据索引中的key
+func dataIndexKey(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+//读取数据索引中携带该数据的交易的位置
+func (tx *StoreTx) dataIndexLocations(data []byte) ([]DataLocation, error) {
+	var locations []DataLocation
+	locationsBytes := tx.backend.get(dataIndexTableName, dataIndexKey(data))
+	if locationsBytes == nil {
+		return locations, nil
+	}
+	err := json.Unmarshal(locationsBytes, &locations)
+	return locations, err
+}
+
+//保存携带该数据的交易的位置，没有交易时删除该数据
+func (tx *StoreTx) putDataIndexLocations(data []byte, locations []DataLocation) error {
+	if len(locations) == 0 {
+		return tx.backend.delete(dataIndexTableName, dataIndexKey(data))
+	}
+	locationsBytes, err := json.Marshal(locations)
+	if err != nil {
+		return err
+	}
+	return tx.backend.put(dataIndexTableName, dataIndexKey(data), locationsBytes)
+}
+
+//将区块中的数据输出加入数据索引，确认数在查询时计算，不保存到索引中
+func (tx *StoreTx) connectDataIndex(b *Block) error {
+	for _, blockTx := range b.Txs {
+		for _, output := range blockTx.TxOutputs {
+			data, ok := output.carriedData()
+			if !ok {
+				continue
+			}
+			locations, err := tx.dataIndexLocations(data)
+			if err != nil {
+				return err
+			}
+			locations = append(locations, DataLocation{Height: b.Height, BlockHash: b.Hash, Timestamp: b.Timestamp, TxHash: blockTx.TxHash})
+			err = tx.putDataIndexLocations(data, locations)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//从数据索引中删除区块中的数据输出
+func (tx *StoreTx) disconnectDataIndex(b *Block) error {
+	for _, blockTx := range b.Txs {
+		for _, output := range blockTx.TxOutputs {
+			data, ok := output.carriedData()
+			if !ok {
+				continue
+			}
+			locations, err := tx.dataIndexLocations(data)
+			if err != nil {
+				return err
+			}
+			kept := locations[:0]
+			for _, location := range locations {
+				if !bytes.Equal(location.BlockHash, b.Hash) {
+					kept = append(kept, location)
+				}
+			}
+			err = tx.putDataIndexLocations(data, kept)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//查找携带了指定数据的所有交易，按区块高度从高到低排列
+//数据索引启用并且已经建立时直接读取索引，否则从最新区块开始遍历区块链
+func (bc *blockChain) FindData(data []byte) []DataLocation {
+	var locations []DataLocation
+	indexed := false
+	var bestHeight int64
+	err := bc.Store.View(func(tx *StoreTx) error {
+		bestHeight = tx.Block(tx.Tip()).Height
+		if !tx.indexReady(dataIndexTableName) {
+			return nil
+		}
+		indexed = true
+		var err error
+		locations, err = tx.dataIndexLocations(data)
+		return err
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if indexed {
+		//索引中按高度从低到高排列，与遍历区块链的顺序相反
+		for i, j := 0, len(locations)-1; i < j; i, j = i+1, j-1 {
+			locations[i], locations[j] = locations[j], locations[i]
+		}
+		for i := range locations {
+			locations[i].Confirmations = bestHeight - locations[i].Height + 1
+		}
+		return locations
+	}
+	var hashInt big.Int
+	iterator := bc.Iterator()
+	for {
+		b := iterator.Next()
+		for _, tx := range b.Txs {
+			for _, output := range tx.TxOutputs {
+				if carried, ok := output.carriedData(); ok && bytes.Equal(carried, data) {
+					locations = append(locations, DataLocation{b.Height, b.Hash, b.Timestamp, tx.TxHash, bestHeight - b.Height + 1})
+				}
+			}
+		}
+		hashInt.SetBytes(b.PrevBlockHash)
+		//如果当前区块的前一个区块的哈希值为0，则认为当前区块已经是创世区块了，跳出循环
+		if hashInt.Cmp(big.NewInt(0)) == 0 {
+			break
+		}
+	}
+	return locations
+}
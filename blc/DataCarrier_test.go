@@ -0,0 +1,94 @@
+package blc
+
+import (
+	"bytes"
+	"testing"
+)
+
+//启用数据索引时FindData的结果与遍历区块链相同，区块断开后索引中的位置也被删除
+func TestFindDataWithIndex(t *testing.T) {
+	resetTestConfig(t)
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	to := string(newTestWallet(t, 2, KeyTypeP256).GetAddress())
+	bc := newTestChain(t, miner)
+	cfg.DataIndex = true
+	if err := bc.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello")
+	for i := 0; i < 2; i++ {
+		tx := newTestTransaction(t, bc, miner, map[string]float64{to: 1}, TxOptions{Data: data})
+		if err := bc.AddBlock(string(miner.GetAddress()), []*transaction{tx}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mineTestBlocks(t, bc, miner, 1)
+
+	indexed := bc.FindData(data)
+	cfg.DataIndex = false
+	walked := bc.FindData(data)
+	cfg.DataIndex = true
+	if len(indexed) != 2 || len(walked) != 2 {
+		t.Fatalf("找到%d个索引位置和%d个遍历位置，应为2个", len(indexed), len(walked))
+	}
+	for i := range indexed {
+		if !bytes.Equal(indexed[i].TxHash, walked[i].TxHash) || indexed[i].Height != walked[i].Height || indexed[i].Confirmations != walked[i].Confirmations {
+			t.Fatalf("第%d个位置不一致：%+v，%+v", i, indexed[i], walked[i])
+		}
+	}
+	if len(bc.FindData([]byte("other"))) != 0 {
+		t.Fatal("找到了不存在的数据")
+	}
+
+	//断开最后一个携带数据的区块
+	err := bc.Store.Update(func(tx *StoreTx) error {
+		return tx.SetTip(tx.Block(tx.BlockHashByHeight(indexed[1].Height)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locations := bc.FindData(data); len(locations) != 1 || !bytes.Equal(locations[0].TxHash, indexed[1].TxHash) {
+		t.Fatalf("断开区块后找到%d个位置，应为1个", len(locations))
+	}
+}
+
+//--datacarriersize参数覆盖配置文件中的值
+func TestDataCarrierSizeFlag(t *testing.T) {
+	resetTestConfig(t)
+	old := MaxDataCarrierSize
+	defer func() { MaxDataCarrierSize = old }()
+	err := loadConfig(map[string]string{"network": regTestParams.Name, "datadir": t.TempDir(), "datacarriersize": "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDataOutput([]byte("12345")); err == nil {
+		t.Fatal("超过datacarriersize的数据被接受")
+	}
+	if _, err := NewDataOutput([]byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(map[string]string{"network": regTestParams.Name, "datadir": t.TempDir(), "datacarriersize": "abc"}); err == nil {
+		t.Fatal("无效的datacarriersize被接受")
+	}
+}
+
+//datacarriersize只影响本节点创建和打包的交易，校验区块时使用共识规则中的限制
+func TestDataCarrierConsensusLimit(t *testing.T) {
+	resetTestConfig(t)
+	old := MaxDataCarrierSize
+	defer func() { MaxDataCarrierSize = old }()
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	to := string(newTestWallet(t, 2, KeyTypeP256).GetAddress())
+	bc := newTestChain(t, miner)
+	tx := newTestTransaction(t, bc, miner, map[string]float64{to: 1}, TxOptions{Data: []byte("12345")})
+	MaxDataCarrierSize = 4
+	if err := tx.checkDataOutputs(MaxDataCarrierSize); err == nil {
+		t.Fatal("超过datacarriersize的交易被接受")
+	}
+	if err := tx.checkDataOutputs(MaxConsensusDataCarrierSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(map[string]string{"network": regTestParams.Name, "datadir": t.TempDir(), "datacarriersize": "81"}); err == nil {
+		t.Fatal("超过共识规则限制的datacarriersize被接受")
+	}
+}
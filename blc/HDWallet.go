@@ -0,0 +1,248 @@
+package blc
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//分层确定性钱包（参照比特币的BIP32），由一个种子派生出所有的私钥和公钥，只需要备份种子就可以恢复所有地址
+
+//派生主密钥时HMAC使用的密钥
+var hdMasterKeySalt = []byte("Study Public Chain seed")
+
+//强化派生的索引起始值，索引大于等于该值时只能由扩展私钥派生
+const hdHardenedOffset = uint32(0x80000000)
+
+//扩展密钥序列化后的长度（不含校验码）
+const hdSerializedKeyLen = 78
+
+//钱包账户的派生路径，钱包地址的派生路径为 hdAccountPath()/0/索引
+func hdAccountPath() string {
+	return fmt.Sprintf("m/44'/%d'/0'", activeNetParams.HDCoinType)
+}
+
+//恢复钱包时，连续多少个未使用的地址之后停止派生
+const hdGapLimit = 20
+
+//扩展密钥
+type ExtendedKey struct {
+	//私钥为32字节，公钥为33字节的压缩公钥
+	Key []byte
+	//链码
+	ChainCode []byte
+	//派生深度，主密钥为0
+	Depth byte
+	//父密钥的指纹
+	ParentFingerprint []byte
+	//在父密钥下的索引
+	ChildIndex uint32
+	//是否为扩展私钥
+	IsPrivate bool
+}
+
+//由种子生成主密钥
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	mac := hmac.New(sha512.New, hdMasterKeySalt)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	keyNum := new(big.Int).SetBytes(sum[:32])
+	if keyNum.Sign() == 0 || keyNum.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, errors.New("种子无法生成有效的主密钥，请更换种子")
+	}
+	return &ExtendedKey{sum[:32], sum[32:], 0, []byte{0, 0, 0, 0}, 0, true}, nil
+}
+
+//返回33字节的压缩公钥
+func (k *ExtendedKey) pubKeyBytes() []byte {
+	if !k.IsPrivate {
+		return k.Key
+	}
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(k.Key)
+	return elliptic.MarshalCompressed(curve, x, y)
+}
+
+//派生子密钥，index大于等于hdHardenedOffset时为强化派生
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	hardened := index >= hdHardenedOffset
+	if hardened && !k.IsPrivate {
+		return nil, errors.New("扩展公钥不能进行强化派生")
+	}
+	var data []byte
+	if hardened {
+		data = append([]byte{0x00}, k.Key...)
+	} else {
+		data = k.pubKeyBytes()
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	curve := elliptic.P256()
+	ilNum := new(big.Int).SetBytes(sum[:32])
+	if ilNum.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("索引%d派生出的密钥无效，请使用下一个索引", index)
+	}
+
+	var childKey []byte
+	if k.IsPrivate {
+		//子私钥 = (IL + 父私钥) mod N
+		keyNum := new(big.Int).Add(ilNum, new(big.Int).SetBytes(k.Key))
+		keyNum.Mod(keyNum, curve.Params().N)
+		if keyNum.Sign() == 0 {
+			return nil, fmt.Errorf("索引%d派生出的密钥无效，请使用下一个索引", index)
+		}
+		childKey = keyNum.FillBytes(make([]byte, 32))
+	} else {
+		//子公钥 = IL*G + 父公钥
+		px, py := elliptic.UnmarshalCompressed(curve, k.Key)
+		if px == nil {
+			return nil, errors.New("扩展公钥无效")
+		}
+		ilx, ily := curve.ScalarBaseMult(sum[:32])
+		cx, cy := curve.Add(ilx, ily, px, py)
+		if cx.Sign() == 0 && cy.Sign() == 0 {
+			return nil, fmt.Errorf("索引%d派生出的密钥无效，请使用下一个索引", index)
+		}
+		childKey = elliptic.MarshalCompressed(curve, cx, cy)
+	}
+	fingerprint := HashPubKey(k.pubKeyBytes())[:4]
+	return &ExtendedKey{childKey, sum[32:], k.Depth + 1, fingerprint, index, k.IsPrivate}, nil
+}
+
+//按照路径派生密钥，例如 m/44'/1'/0'/0/1，带'的索引为强化派生
+func (k *ExtendedKey) DerivePath(path string) (*ExtendedKey, error) {
+	segments := strings.Split(path, "/")
+	if segments[0] != "m" {
+		return nil, errors.New("派生路径必须以m开头")
+	}
+	key := k
+	for _, segment := range segments[1:] {
+		var offset uint32
+		if strings.HasSuffix(segment, "'") {
+			offset = hdHardenedOffset
+			segment = strings.TrimSuffix(segment, "'")
+		}
+		index, err := strconv.ParseUint(segment, 10, 31)
+		if err != nil {
+			return nil, errors.New("派生路径" + path + "无效")
+		}
+		key, err = key.Child(uint32(index) + offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+//返回扩展私钥对应的扩展公钥
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.IsPrivate {
+		return k
+	}
+	return &ExtendedKey{k.pubKeyBytes(), k.ChainCode, k.Depth, k.ParentFingerprint, k.ChildIndex, false}
+}
+
+//将扩展私钥转换为指定密钥类型的钱包，P-256的私钥一定小于secp256k1的N，因此也是有效的secp256k1私钥
+//扩展公钥只能派生P-256的公钥
+func (k *ExtendedKey) toWallet(path string, keyType byte) (*Wallet, error) {
+	if !k.IsPrivate {
+		return nil, errors.New("扩展公钥不能转换为钱包")
+	}
+	return newWalletFromKey(k.Key, keyType, path)
+}
+
+//返回扩展私钥可以转换成的所有钱包：压缩公钥的P-256钱包以及其他密钥类型的钱包，恢复钱包时使用
+func (k *ExtendedKey) walletCandidates(path string) ([]*Wallet, error) {
+	var wallets []*Wallet
+	for _, keyType := range signatureKeyTypes {
+		wallet, err := k.toWallet(path, keyType)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets, nil
+}
+
+//返回扩展密钥对应的钱包公钥，即33字节的压缩公钥，与新创建的钱包中的公钥一致
+func (k *ExtendedKey) publicKey() []byte {
+	return k.pubKeyBytes()
+}
+
+//返回扩展密钥对应的钱包地址
+func (k *ExtendedKey) Address() string {
+	return string(encodeAddress(activeNetParams.PubKeyHashAddrID, HashPubKey(k.publicKey())))
+}
+
+//将扩展密钥序列化为字符串：版本号(4) 深度(1) 父密钥指纹(4) 索引(4) 链码(32) 密钥(33) 校验码(4)，再进行base58编码
+func (k *ExtendedKey) String() string {
+	var buff bytes.Buffer
+	if k.IsPrivate {
+		buff.Write(activeNetParams.HDPrivateKeyID)
+	} else {
+		buff.Write(activeNetParams.HDPublicKeyID)
+	}
+	buff.WriteByte(k.Depth)
+	buff.Write(k.ParentFingerprint)
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, k.ChildIndex)
+	buff.Write(indexBytes)
+	buff.Write(k.ChainCode)
+	if k.IsPrivate {
+		buff.WriteByte(0x00)
+	}
+	buff.Write(k.Key)
+	buff.Write(checksum(buff.Bytes()))
+	return string(Base58Encode(buff.Bytes()))
+}
+
+//将字符串解析为扩展密钥
+func ParseExtendedKey(key string) (*ExtendedKey, error) {
+	decoded, err := Base58Decode([]byte(key))
+	if err != nil {
+		return nil, errors.New("扩展密钥" + err.Error())
+	}
+	if len(decoded) != hdSerializedKeyLen+addressChecksumLen {
+		return nil, errors.New("扩展密钥的长度无效")
+	}
+	payload := decoded[:hdSerializedKeyLen]
+	if !bytes.Equal(checksum(payload), decoded[hdSerializedKeyLen:]) {
+		return nil, errors.New("扩展密钥的校验码无效")
+	}
+	k := &ExtendedKey{
+		Depth:             payload[4],
+		ParentFingerprint: payload[5:9],
+		ChildIndex:        binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode:         payload[13:45],
+	}
+	switch {
+	case bytes.Equal(payload[:4], activeNetParams.HDPrivateKeyID) && payload[45] == 0x00:
+		k.IsPrivate = true
+		k.Key = payload[46:]
+	case bytes.Equal(payload[:4], activeNetParams.HDPublicKeyID):
+		if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), payload[45:]); x == nil {
+			return nil, errors.New("扩展公钥无效")
+		}
+		k.Key = payload[45:]
+	default:
+		return nil, errors.New("扩展密钥的版本号无效")
+	}
+	return k, nil
+}
+
+//返回第index个钱包地址的派生路径
+func hdAddressPath(index uint32) string {
+	return fmt.Sprintf("%s/0/%d", hdAccountPath(), index)
+}
@@ -0,0 +1,55 @@
+package blc
+
+import (
+	"strings"
+	"testing"
+)
+
+//扩展密钥的前缀和派生路径与比特币不同，比特币的扩展密钥不能导入
+func TestExtendedKeyVersions(t *testing.T) {
+	defer SelectNetwork(regTestParams.Name)
+	seed := make([]byte, 32)
+	tests := []struct {
+		network     string
+		prv, pub    string
+		accountPath string
+	}{
+		{mainNetParams.Name, "sprv", "spub", "m/44'/21328'/0'"},
+		{testNetParams.Name, "tsrv", "tsub", "m/44'/1'/0'"},
+		{regTestParams.Name, "tsrv", "tsub", "m/44'/1'/0'"},
+	}
+	for _, test := range tests {
+		if err := SelectNetwork(test.network); err != nil {
+			t.Fatal(err)
+		}
+		if hdAccountPath() != test.accountPath {
+			t.Errorf("%s的账户路径为%s，应为%s", test.network, hdAccountPath(), test.accountPath)
+		}
+		master, err := NewMasterKey(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account, err := master.DerivePath(hdAccountPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for prefix, key := range map[string]*ExtendedKey{test.prv: account, test.pub: account.Neuter()} {
+			encoded := key.String()
+			if !strings.HasPrefix(encoded, prefix) {
+				t.Errorf("%s的扩展密钥%s应以%s开头", test.network, encoded, prefix)
+			}
+			parsed, err := ParseExtendedKey(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.String() != encoded {
+				t.Errorf("%s的扩展密钥解析后不一致", test.network)
+			}
+		}
+	}
+	//比特币BIP32测试向量1的主扩展公钥
+	bitcoinXpub := "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	if _, err := ParseExtendedKey(bitcoinXpub); err == nil {
+		t.Fatal("比特币的扩展公钥被接受")
+	}
+}
@@ -0,0 +1,219 @@
+package blc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+//哈希时间锁合约中秘密值的长度
+const htlcSecretSize = 32
+
+//哈希时间锁合约（HTLC）：
+//收款方提供秘密值和自己的签名即可领取；到达锁定时间后，汇款方可以用自己的签名取回
+type htlcContract struct {
+	//秘密值的SHA-256哈希
+	SecretHash []byte
+	//收款方的公钥哈希
+	RecipientHash []byte
+	//退款方（汇款方）的公钥哈希
+	RefundHash []byte
+	//退款的锁定时间
+	LockTime int64
+	//收款方的密钥类型
+	RecipientKeyType byte
+	//退款方的密钥类型
+	RefundKeyType byte
+}
+
+//创建合约脚本：
+//<收款方密钥类型 退款方密钥类型> OP_DROP
+//OP_IF OP_SIZE 32 OP_EQUALVERIFY OP_SHA256 <秘密值哈希> OP_EQUALVERIFY OP_DUP OP_HASH160 <收款方公钥哈希>
+//OP_ELSE <锁定时间> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <退款方公钥哈希>
+//OP_ENDIF OP_EQUALVERIFY OP_CHECKSIG
+//公钥哈希中不能看出密钥类型，脚本开头记录双方的密钥类型后立即丢弃，审核合约时用于还原双方的地址
+func (c *htlcContract) Script() []byte {
+	sb := &scriptBuilder{}
+	sb.addData([]byte{c.RecipientKeyType, c.RefundKeyType}).addOp(OP_DROP)
+	sb.addOp(OP_IF)
+	sb.addOp(OP_SIZE).addInt(htlcSecretSize).addOp(OP_EQUALVERIFY)
+	sb.addOp(OP_SHA256).addData(c.SecretHash).addOp(OP_EQUALVERIFY)
+	sb.addOp(OP_DUP).addOp(OP_HASH160).addData(c.RecipientHash)
+	sb.addOp(OP_ELSE)
+	sb.addInt(c.LockTime).addOp(OP_CHECKLOCKTIMEVERIFY).addOp(OP_DROP)
+	sb.addOp(OP_DUP).addOp(OP_HASH160).addData(c.RefundHash)
+	sb.addOp(OP_ENDIF)
+	sb.addOp(OP_EQUALVERIFY).addOp(OP_CHECKSIG)
+	return sb.Script()
+}
+
+//解析合约脚本
+func parseHTLCScript(script []byte) (*htlcContract, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	//除数据以外，合约脚本中的每一条指令都必须与模板一致
+	template, _ := parseScript((&htlcContract{make([]byte, 32), make([]byte, 20), make([]byte, 20), lockTimeThreshold, KeyTypeP256, KeyTypeP256}).Script())
+	if len(ops) != len(template) {
+		return nil, errors.New("不是哈希时间锁合约脚本")
+	}
+	for i, op := range ops {
+		if i == 0 || i == 4 || i == 7 || i == 11 || i == 13 || i == 18 {
+			continue
+		}
+		if op.Opcode != template[i].Opcode {
+			return nil, errors.New("不是哈希时间锁合约脚本")
+		}
+	}
+	if len(ops[0].Data) != 2 {
+		return nil, errors.New("不是哈希时间锁合约脚本")
+	}
+	for _, keyType := range ops[0].Data {
+		if _, ok := signatureSchemes[keyType]; !ok {
+			return nil, fmt.Errorf("合约中的密钥类型0x%02x无效", keyType)
+		}
+	}
+	if size, ok := ops[4].smallInt(); (ok && size != htlcSecretSize) || (!ok && scriptNumToInt(ops[4].Data) != htlcSecretSize) {
+		return nil, errors.New("不是哈希时间锁合约脚本")
+	}
+	if len(ops[7].Data) != sha256.Size || len(ops[11].Data) != 20 || len(ops[18].Data) != 20 {
+		return nil, errors.New("不是哈希时间锁合约脚本")
+	}
+	lockTime := scriptNumToInt(ops[13].Data)
+	if n, ok := ops[13].smallInt(); ok {
+		lockTime = int64(n)
+	}
+	return &htlcContract{ops[7].Data, ops[11].Data, ops[18].Data, lockTime, ops[0].Data[0], ops[0].Data[1]}, nil
+}
+
+//收款方的地址，地址的版本号由收款方的密钥类型决定
+func (c *htlcContract) recipientAddress() string {
+	return string(encodeAddress(signatureSchemes[c.RecipientKeyType].addressVersion(), c.RecipientHash))
+}
+
+//退款方的地址
+func (c *htlcContract) refundAddress() string {
+	return string(encodeAddress(signatureSchemes[c.RefundKeyType].addressVersion(), c.RefundHash))
+}
+
+//从地址中取出公钥哈希和密钥类型，只支持公钥哈希地址
+func pubKeyHashFromAddress(address string) ([]byte, byte, error) {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	scheme, ok := schemeByAddressVersion(addr.Version)
+	if !ok {
+		return nil, 0, errors.New("地址" + address + "不是公钥哈希地址")
+	}
+	return addr.Payload, scheme.keyType(), nil
+}
+
+//创建汇款方为from、收款方为to的合约脚本
+func newHTLCContract(from, to string, secretHash []byte, lockTime int64) ([]byte, error) {
+	if len(secretHash) != sha256.Size {
+		return nil, errors.New("秘密值哈希的长度必须为32字节")
+	}
+	if lockTime <= 0 {
+		return nil, errors.New("锁定时间必须大于0")
+	}
+	refundHash, refundKeyType, err := pubKeyHashFromAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	recipientHash, recipientKeyType, err := pubKeyHashFromAddress(to)
+	if err != nil {
+		return nil, err
+	}
+	return (&htlcContract{secretHash, recipientHash, refundHash, lockTime, recipientKeyType, refundKeyType}).Script(), nil
+}
+
+//创建哈希时间锁合约交易，将amount锁定到合约的P2SH地址中，返回交易和合约脚本
+func NewHTLCTransaction(from, to string, amount float64, secretHash []byte, lockTime int64, bc *blockChain) (*transaction, []byte, error) {
+	contract, err := newHTLCContract(from, to, secretHash, lockTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := NewTransaction(from, map[string]float64{ScriptHashAddress(contract): amount}, TxOptions{}, bc)
+	return tx, contract, nil
+}
+
+//查找合约交易中锁定到合约的输出
+func findContractOutput(contractTx *transaction, contract []byte) (int64, *TxOutput, error) {
+	lockScript := buildScriptHashScript(HashPubKey(contract))
+	for i, output := range contractTx.TxOutputs {
+		if bytes.Equal(output.ScriptPubKey, lockScript) {
+			return int64(i), output, nil
+		}
+	}
+	return 0, nil, errors.New("交易中不存在锁定到该合约的输出")
+}
+
+//创建花费合约输出的交易：secret不为空时由收款方领取，否则由汇款方在锁定时间之后退款
+func NewHTLCSpendTransaction(contract []byte, contractTx *transaction, secret []byte, wallet *Wallet) (*transaction, error) {
+	c, err := parseHTLCScript(contract)
+	if err != nil {
+		return nil, err
+	}
+	vout, output, err := findContractOutput(contractTx, contract)
+	if err != nil {
+		return nil, err
+	}
+	var lockTime int64
+	if secret != nil {
+		hash := sha256.Sum256(secret)
+		if !bytes.Equal(hash[:], c.SecretHash) {
+			return nil, errors.New("秘密值与合约中的秘密值哈希不匹配")
+		}
+		if !bytes.Equal(HashPubKey(wallet.addressPubKey()), c.RecipientHash) {
+			return nil, errors.New("钱包地址不是合约的收款方")
+		}
+	} else {
+		if !bytes.Equal(HashPubKey(wallet.addressPubKey()), c.RefundHash) {
+			return nil, errors.New("钱包地址不是合约的退款方")
+		}
+		//退款交易必须在合约的锁定时间之后才能打包
+		lockTime = c.LockTime
+	}
+	if wallet.isLocked() {
+		return nil, errWalletLocked
+	}
+	input := &TxInput{TXHash: contractTx.TxHash, Vout: vout}
+	tx := &transaction{[]byte{}, []*TxInput{input}, []*TxOutput{NewTXOutput(output.Value, string(wallet.GetAddress()))}, lockTime}
+	tx.TxHash = tx.hashTransaction()
+	//解锁脚本：领取时为 <签名> <公钥> <秘密值> OP_1 <合约>，退款时为 <签名> <公钥> OP_0 <合约>
+	sb := &scriptBuilder{}
+	sb.addData(wallet.sign(tx.signatureHash(0, contract, output.Value))).addData(wallet.addressPubKey())
+	if secret != nil {
+		sb.addData(secret).addSmallInt(1)
+	} else {
+		sb.addSmallInt(0)
+	}
+	sb.addData(contract)
+	input.ScriptSig = sb.Script()
+	return tx, nil
+}
+
+//从领取合约的交易的解锁脚本中取出秘密值
+func extractHTLCSecret(input *TxInput) ([]byte, error) {
+	ops, err := parseScript(input.ScriptSig)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) != 5 || ops[3].Opcode != OP_1 {
+		return nil, errors.New("该输入不是领取合约的输入")
+	}
+	return ops[2].Data, nil
+}
+
+//根据公钥哈希找出对应的钱包
+func findWalletByPubKeyHash(wallets map[string]*Wallet, pubKeyHash []byte) (*Wallet, error) {
+	for _, wallet := range wallets {
+		if bytes.Equal(HashPubKey(wallet.addressPubKey()), pubKeyHash) {
+			return wallet, nil
+		}
+	}
+	return nil, fmt.Errorf("钱包中不存在公钥哈希为%x的地址", pubKeyHash)
+}
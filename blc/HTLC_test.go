@@ -0,0 +1,121 @@
+package blc
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+//在两条独立的链上完成一次原子交换：
+//alice在链A上锁定给bob，bob审核后在链B上用同一个秘密值哈希锁定给alice，
+//alice用秘密值在链B上领取，bob从alice的领取交易中取出秘密值后在链A上领取
+func TestHTLCAtomicSwap(t *testing.T) {
+	alice := newTestWallet(t, 1, KeyTypeSchnorr)
+	bob := newTestWallet(t, 2, KeyTypeSecp256k1)
+	aliceAddr := string(alice.GetAddress())
+	bobAddr := string(bob.GetAddress())
+	chainA := newTestChain(t, alice)
+	chainB := createBlockChainInStore(NewMemoryStore(), bobAddr)
+
+	secret := make([]byte, htlcSecretSize)
+	for i := range secret {
+		secret[i] = byte(i)
+	}
+	secretHash := sha256.Sum256(secret)
+
+	//alice发起合约，bob的合约锁定时间更短，保证alice退款之前bob已经可以退款
+	contractA, err := newHTLCContract(aliceAddr, bobAddr, secretHash[:], 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txA := newTestTransaction(t, chainA, alice, map[string]float64{ScriptHashAddress(contractA): 4}, TxOptions{})
+	if err := chainA.AddBlock(aliceAddr, []*transaction{txA}); err != nil {
+		t.Fatal(err)
+	}
+
+	//bob审核合约：收款方和退款方的地址必须带有各自密钥类型的版本号
+	c, err := parseHTLCScript(contractA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.recipientAddress() != bobAddr || c.refundAddress() != aliceAddr {
+		t.Fatalf("合约双方为%s和%s，应为%s和%s", c.recipientAddress(), c.refundAddress(), bobAddr, aliceAddr)
+	}
+	if _, output, err := findContractOutput(txA, contractA); err != nil || output.Value != 4 {
+		t.Fatalf("合约输出错误：%v", err)
+	}
+
+	contractB, err := newHTLCContract(bobAddr, aliceAddr, c.SecretHash, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txB := newTestTransaction(t, chainB, bob, map[string]float64{ScriptHashAddress(contractB): 3}, TxOptions{})
+	if err := chainB.AddBlock(bobAddr, []*transaction{txB}); err != nil {
+		t.Fatal(err)
+	}
+
+	//锁定时间之前不能退款
+	refund, err := NewHTLCSpendTransaction(contractB, txB, nil, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chainB.AddBlock(bobAddr, []*transaction{refund}); err == nil {
+		t.Fatal("锁定时间之前的退款交易被接受")
+	}
+	//秘密值错误时不能领取
+	if _, err := NewHTLCSpendTransaction(contractB, txB, make([]byte, htlcSecretSize), alice); err == nil {
+		t.Fatal("错误的秘密值被接受")
+	}
+
+	//alice在链B上领取
+	redeemB, err := NewHTLCSpendTransaction(contractB, txB, secret, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chainB.AddBlock(bobAddr, []*transaction{redeemB}); err != nil {
+		t.Fatal(err)
+	}
+	if balance := chainB.GetBalance(aliceAddr); balance != 3 {
+		t.Fatalf("alice在链B上的余额为%f，应为3", balance)
+	}
+
+	//bob从链B上的领取交易中取出秘密值，在链A上领取
+	voutB, _, _ := findContractOutput(txB, contractB)
+	spending, inputIndex, err := chainB.findSpendingTransaction(txB.TxHash, voutB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revealed, err := extractHTLCSecret(spending.TxInputs[inputIndex])
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeemA, err := NewHTLCSpendTransaction(contractA, txA, revealed, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chainA.AddBlock(aliceAddr, []*transaction{redeemA}); err != nil {
+		t.Fatal(err)
+	}
+	if balance := chainA.GetBalance(bobAddr); balance != 4 {
+		t.Fatalf("bob在链A上的余额为%f，应为4", balance)
+	}
+	voutA, _, _ := findContractOutput(txA, contractA)
+	if chainA.isUnspent(txA.TxHash, voutA) || chainB.isUnspent(txB.TxHash, voutB) {
+		t.Fatal("合约输出领取后仍未花费")
+	}
+}
+
+//合约中记录的密钥类型必须有效
+func TestParseHTLCScriptRejectsUnknownKeyType(t *testing.T) {
+	c := &htlcContract{make([]byte, 32), make([]byte, 20), make([]byte, 20), 100, KeyTypeP256, 0x7f}
+	if _, err := parseHTLCScript(c.Script()); err == nil {
+		t.Fatal("未知的密钥类型被接受")
+	}
+	c.RefundKeyType = KeyTypeSecp256k1
+	parsed, err := parseHTLCScript(c.Script())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.RecipientKeyType != KeyTypeP256 || parsed.RefundKeyType != KeyTypeSecp256k1 || parsed.LockTime != 100 {
+		t.Fatalf("解析结果错误：%+v", parsed)
+	}
+}
@@ -0,0 +1,269 @@
+package blc
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+//区块高度索引：记录最长链上每个高度的区块哈希值，key为8字节大端序的区块高度，因此按键遍历即按高度遍历
+//索引随最新区块的更新而维护：SetTip连接新的区块时写入索引，切换到其他分叉时先删除比新区块高的记录，再沿着新分叉向前改写不一致的记录
+//UTXO池和可选的索引（交易索引、地址索引和数据索引）也在区块连接和断开时由SetTip更新，与最新区块在同一个事务中提交
+
+//区块高度索引所在的数据库表
+const heightTableName = "heights"
+
+//记录可选的索引是否已经完整建立的数据库表，key为索引所在的数据库表
+const indexStateTableName = "indexes"
+
+//最长链上某个高度的区块哈希值，高度超出范围时返回nil
+func (tx *StoreTx) BlockHashByHeight(height int64) []byte {
+	return tx.backend.get(heightTableName, IntToBytes(height))
+}
+
+//将b设为最新的区块，并更新区块高度索引、UTXO池和其他启用的索引，b及其之前的区块都必须已经保存
+//这是修改最新区块的唯一方式，保证最新区块与UTXO池和各个索引一致，连接的区块花费了不存在的输出时返回错误
+func (tx *StoreTx) SetTip(b *Block) error {
+	//从高到低断开比新的最新区块更高的区块
+	top := b.Height
+	for tx.BlockHashByHeight(top+1) != nil {
+		top++
+	}
+	for height := top; height > b.Height; height-- {
+		err := tx.disconnectHeight(height)
+		if err != nil {
+			return err
+		}
+	}
+	//从新的最新区块向前找出需要连接的区块，直到与索引中已有的记录一致，同时断开原来分叉上的区块
+	var connected []*Block
+	for curr := b; ; {
+		hash := tx.BlockHashByHeight(curr.Height)
+		if bytes.Equal(hash, curr.Hash) {
+			break
+		}
+		if hash != nil {
+			err := tx.disconnectHeight(curr.Height)
+			if err != nil {
+				return err
+			}
+		}
+		connected = append(connected, curr)
+		if curr.Height == 0 {
+			break
+		}
+		prev := tx.Block(curr.PrevBlockHash)
+		if prev == nil {
+			return fmt.Errorf("区块%x的前一个区块%x不存在", curr.Hash, curr.PrevBlockHash)
+		}
+		curr = prev
+	}
+	//从低到高连接区块
+	for i := len(connected) - 1; i >= 0; i-- {
+		err := tx.backend.put(heightTableName, IntToBytes(connected[i].Height), connected[i].Hash)
+		if err != nil {
+			return err
+		}
+		err = tx.connectBlock(connected[i])
+		if err != nil {
+			return err
+		}
+	}
+	return tx.backend.put(tableName, []byte(lastHashKey), b.Hash)
+}
+
+//从最长链上断开某个高度的区块
+func (tx *StoreTx) disconnectHeight(height int64) error {
+	b := tx.Block(tx.BlockHashByHeight(height))
+	if b != nil {
+		err := tx.disconnectBlock(b)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.backend.delete(heightTableName, IntToBytes(height))
+}
+
+//区块连接到最长链时，更新UTXO池、钱包账本和启用的索引
+//UTXO池从创世区块开始由SetTip维护时才有完整的回滚数据，连接创世区块时记录标记
+func (tx *StoreTx) connectBlock(b *Block) error {
+	prevOutputs, err := tx.connectUTXOs(b)
+	if err != nil {
+		return err
+	}
+	err = tx.connectWalletLedger(b, prevOutputs)
+	if err != nil {
+		return err
+	}
+	if b.Height == 0 {
+		err = tx.backend.put(indexStateTableName, []byte(utxoUndoTableName), []byte{1})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.connectBlockIndexes(b)
+}
+
+//区块从最长链上断开时，先更新钱包账本和启用的索引，再恢复UTXO池
+func (tx *StoreTx) disconnectBlock(b *Block) error {
+	err := tx.disconnectWalletLedger(b)
+	if err != nil {
+		return err
+	}
+	err = tx.disconnectBlockIndexes(b)
+	if err != nil {
+		return err
+	}
+	return tx.disconnectUTXOs(b)
+}
+
+//可选的索引，key为索引所在的数据库表，value为是否启用
+func optionalIndexes() map[string]bool {
+	return map[string]bool{
+		txIndexTableName:   cfg.TxIndex,
+		addrIndexTableName: cfg.AddrIndex,
+		dataIndexTableName: cfg.DataIndex,
+	}
+}
+
+//区块连接到最长链时，更新启用的索引
+//从创世区块开始一直维护的索引才是完整的，连接创世区块时标记索引已建立，未启用时连接或断开区块都会清除标记
+func (tx *StoreTx) connectBlockIndexes(b *Block) error {
+	for table, enabled := range optionalIndexes() {
+		var err error
+		switch {
+		case !enabled:
+			err = tx.backend.delete(indexStateTableName, []byte(table))
+		case b.Height == 0:
+			err = tx.backend.put(indexStateTableName, []byte(table), []byte{1})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.TxIndex {
+		err := tx.connectTxIndex(b)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.AddrIndex {
+		err := tx.connectAddrIndex(b)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.DataIndex {
+		return tx.connectDataIndex(b)
+	}
+	return nil
+}
+
+//区块从最长链上断开时，更新启用的索引
+func (tx *StoreTx) disconnectBlockIndexes(b *Block) error {
+	for table, enabled := range optionalIndexes() {
+		if !enabled {
+			err := tx.backend.delete(indexStateTableName, []byte(table))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.DataIndex {
+		err := tx.disconnectDataIndex(b)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.AddrIndex {
+		err := tx.disconnectAddrIndex(b)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.TxIndex {
+		return tx.disconnectTxIndex(b)
+	}
+	return nil
+}
+
+//索引是否启用并且已经完整建立
+func (tx *StoreTx) indexReady(table string) bool {
+	return optionalIndexes()[table] && tx.backend.get(indexStateTableName, []byte(table)) != nil
+}
+
+//检查最新区块与高度索引是否一致，以及UTXO池是否有回滚数据，否则（例如旧版本创建的数据库）重建索引和UTXO池
+func (bc *blockChain) ensureHeightIndex() {
+	consistent := true
+	err := bc.Store.View(func(tx *StoreTx) error {
+		tip := tx.Block(tx.Tip())
+		consistent = bytes.Equal(tx.BlockHashByHeight(tip.Height), tip.Hash) && tx.BlockHashByHeight(tip.Height+1) == nil &&
+			tx.backend.get(indexStateTableName, []byte(utxoUndoTableName)) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if consistent {
+		return
+	}
+	err = bc.Reindex()
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+//重建区块高度索引、UTXO池和启用的索引，未启用的索引被删除，钱包账本被清空，查询时重新扫描
+func (bc *blockChain) Reindex() error {
+	return bc.Store.Update(func(tx *StoreTx) error {
+		for _, table := range []string{heightTableName, indexStateTableName, utxoTableName, utxoUndoTableName, txIndexTableName, addrIndexTableName, addrIndexOutPointTableName, dataIndexTableName,
+			walletLedgerTableName, walletLedgerAddressTableName, walletLedgerBlockTableName} {
+			err := tx.DeleteTable(table)
+			if err != nil {
+				return err
+			}
+		}
+		tip := tx.Block(tx.Tip())
+		if tip == nil {
+			return fmt.Errorf("最新的区块%x不存在", tx.Tip())
+		}
+		//高度索引为空，SetTip会从创世区块开始重新连接最长链上的所有区块
+		return tx.SetTip(tip)
+	})
+}
+
+//根据高度获取最长链上的区块
+func (bc *blockChain) GetBlockByHeight(height int64) (*Block, error) {
+	var b *Block
+	err := bc.Store.View(func(tx *StoreTx) error {
+		hash := tx.BlockHashByHeight(height)
+		if hash == nil {
+			return fmt.Errorf("高度为%d的区块不存在", height)
+		}
+		b = tx.Block(hash)
+		return nil
+	})
+	return b, err
+}
+
+//获取最长链上高度从from到to（包括to）的区块哈希值，按高度从低到高排列，超出最新区块高度的部分被忽略
+func (bc *blockChain) GetBlockHashes(from, to int64) [][]byte {
+	var blockHashs [][]byte
+	err := bc.Store.View(func(tx *StoreTx) error {
+		if from < 0 {
+			from = 0
+		}
+		for height := from; height <= to; height++ {
+			hash := tx.BlockHashByHeight(height)
+			if hash == nil {
+				break
+			}
+			blockHashs = append(blockHashs, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return blockHashs
+}
@@ -0,0 +1,62 @@
+package blc
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+//测试中使用regtest网络，不需要工作量证明，区块链保存在内存存储中，不需要磁盘上的文件
+func TestMain(m *testing.M) {
+	//挖矿和交易的日志太多，测试时不输出
+	log.SetOutput(io.Discard)
+	if err := SelectNetwork(regTestParams.Name); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+//由固定的私钥创建钱包，seed不同则钱包不同
+func newTestWallet(t testing.TB, seed byte, keyType byte) *Wallet {
+	t.Helper()
+	d := make([]byte, 32)
+	d[31] = seed
+	wallet, err := newWalletFromKey(d, keyType, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+//在内存存储中创建区块链，创世块之后的第一个区块的挖矿奖励发给miner
+func newTestChain(t testing.TB, miner *Wallet) *blockChain {
+	t.Helper()
+	resetTestConfig(t)
+	return createBlockChainInStore(NewMemoryStore(), string(miner.GetAddress()))
+}
+
+//测试结束后恢复默认配置，测试可以修改cfg来启用索引
+func resetTestConfig(t testing.TB) {
+	old := cfg
+	cfg = defaultConfig()
+	t.Cleanup(func() { cfg = old })
+}
+
+//创建从from转出并已签名的交易
+func newTestTransaction(t testing.TB, bc *blockChain, from *Wallet, tos map[string]float64, opts TxOptions) *transaction {
+	t.Helper()
+	tx := newUnsignedTransaction(string(from.GetAddress()), from.addressPubKey(), tos, opts, bc)
+	bc.SignTransaction(tx, from)
+	return tx
+}
+
+//挖出n个只有coinbase交易的区块
+func mineTestBlocks(t testing.TB, bc *blockChain, miner *Wallet, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := bc.AddBlock(string(miner.GetAddress()), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
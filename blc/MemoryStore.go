@@ -0,0 +1,184 @@
+package blc
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+//只保存在内存中的存储，用于测试，不需要磁盘上的文件
+//读写事务中的修改先记录在事务中，fn成功返回后才写入存储，因此fn返回错误时存储不受影响
+type memoryStore struct {
+	//读写事务之间互斥，读写事务与只读事务之间也互斥
+	lock sync.RWMutex
+	//key为表名，value为表中的键值对
+	tables map[string]map[string][]byte
+	closed bool
+}
+
+//创建内存存储
+func NewMemoryStore() ChainStore {
+	return &memoryStore{tables: make(map[string]map[string][]byte)}
+}
+
+func (store *memoryStore) View(fn func(tx *StoreTx) error) error {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	if store.closed {
+		return errors.New("存储已关闭")
+	}
+	return fn(&StoreTx{&memoryStoreTx{store: store}})
+}
+
+func (store *memoryStore) Update(fn func(tx *StoreTx) error) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.closed {
+		return errors.New("存储已关闭")
+	}
+	tx := &memoryStoreTx{store: store, writable: true, changes: make(map[string]*memoryTableChanges)}
+	err := fn(&StoreTx{tx})
+	if err != nil {
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+func (store *memoryStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.closed = true
+	return nil
+}
+
+//事务中对一个表的修改
+type memoryTableChanges struct {
+	//是否删除了整个表，为true时表中原有的键值对都不可见
+	cleared bool
+	//写入的键值对，value为nil表示删除
+	values map[string][]byte
+}
+
+//内存存储的事务
+type memoryStoreTx struct {
+	store    *memoryStore
+	writable bool
+	//key为表名
+	changes map[string]*memoryTableChanges
+}
+
+func (t *memoryStoreTx) tableChanges(table string) *memoryTableChanges {
+	changes, ok := t.changes[table]
+	if !ok {
+		changes = &memoryTableChanges{values: make(map[string][]byte)}
+		t.changes[table] = changes
+	}
+	return changes
+}
+
+func (t *memoryStoreTx) get(table string, key []byte) []byte {
+	if changes, ok := t.changes[table]; ok {
+		if value, ok := changes.values[string(key)]; ok {
+			return copyBytes(value)
+		}
+		if changes.cleared {
+			return nil
+		}
+	}
+	return copyBytes(t.store.tables[table][string(key)])
+}
+
+func (t *memoryStoreTx) put(table string, key, value []byte) error {
+	if !t.writable {
+		return errors.New("只读事务不能写入数据")
+	}
+	//空值也要与删除区分开
+	t.tableChanges(table).values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (t *memoryStoreTx) delete(table string, key []byte) error {
+	if !t.writable {
+		return errors.New("只读事务不能删除数据")
+	}
+	t.tableChanges(table).values[string(key)] = nil
+	return nil
+}
+
+func (t *memoryStoreTx) forEach(table string, fn func(key, value []byte) error) error {
+	merged := make(map[string][]byte)
+	changes, changed := t.changes[table]
+	if !changed || !changes.cleared {
+		for k, v := range t.store.tables[table] {
+			merged[k] = v
+		}
+	}
+	if changed {
+		for k, v := range changes.values {
+			if v == nil {
+				delete(merged, k)
+			} else {
+				merged[k] = v
+			}
+		}
+	}
+	//与BoltDB相同，按键的字节顺序遍历
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err := fn([]byte(k), copyBytes(merged[k]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//内存存储只用于测试，遍历整个表，跳过不以prefix开头的键
+func (t *memoryStoreTx) forEachPrefix(table string, prefix []byte, fn func(key, value []byte) error) error {
+	return t.forEach(table, func(key, value []byte) error {
+		if !bytes.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key, value)
+	})
+}
+
+func (t *memoryStoreTx) deleteTable(table string) error {
+	if !t.writable {
+		return errors.New("只读事务不能删除表")
+	}
+	t.changes[table] = &memoryTableChanges{cleared: true, values: make(map[string][]byte)}
+	return nil
+}
+
+//将事务中的修改写入存储
+func (t *memoryStoreTx) commit() {
+	for table, changes := range t.changes {
+		values := t.store.tables[table]
+		if values == nil || changes.cleared {
+			values = make(map[string][]byte)
+			t.store.tables[table] = values
+		}
+		for k, v := range changes.values {
+			if v == nil {
+				delete(values, k)
+			} else {
+				values[k] = v
+			}
+		}
+	}
+}
+
+//复制字节数组，nil返回nil
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
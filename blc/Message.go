@@ -0,0 +1,81 @@
+package blc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+//消息签名：用钱包地址的私钥对消息签名，不需要转账就可以证明拥有某个地址
+//签名的是加上固定前缀后的消息的哈希值，防止对消息的签名被当作交易的签名使用
+//签名可以恢复出公钥，验证时只需要地址、签名和消息
+
+//消息签名的前缀
+const messageMagic = "Study Public Chain Signed Message:\n"
+
+//计算消息签名的哈希值：前缀和消息都加上长度，再进行两次256哈希
+func messageHash(message string) []byte {
+	var content bytes.Buffer
+	for _, data := range []string{messageMagic, message} {
+		lenBytes := make([]byte, binary.MaxVarintLen64)
+		content.Write(lenBytes[:binary.PutUvarint(lenBytes, uint64(len(data)))])
+		content.WriteString(data)
+	}
+	first := sha256.Sum256(content.Bytes())
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+//用钱包中地址的私钥对消息签名，返回base64编码的签名
+func SignMessage(nodeId, address, message string) (string, error) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return "", err
+	}
+	address = canonicalAddress(address)
+	wallet, ok := wf.Wallets[address]
+	if !ok {
+		if _, ok := wf.WatchOnly[address]; ok {
+			return "", errors.New("只读地址" + address + "没有私钥，不能签名")
+		}
+		return "", errors.New("当前节点的钱包中不存在地址" + address)
+	}
+	if wallet.isLocked() {
+		return "", errWalletLocked
+	}
+	d := wallet.PrivateKey.D.FillBytes(make([]byte, sigScalarLen))
+	//P-256的钱包可能使用未压缩公钥，恢复出的公钥需要与钱包中的公钥格式一致
+	compressed := wallet.KeyType != KeyTypeP256 || isCompressedP256PublicKey(wallet.PublicKey)
+	signature := wallet.scheme().signCompact(d, messageHash(message), compressed)
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+//验证消息的签名：由签名恢复出公钥，公钥的哈希值必须与地址中的公钥哈希相同
+func VerifyMessage(address, signature, message string) error {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	scheme, ok := schemeByAddressVersion(addr.Version)
+	if !ok {
+		return errors.New("地址" + address + "不是公钥哈希地址，不能验证消息签名")
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("签名不是有效的base64编码")
+	}
+	pubKey, err := scheme.recoverCompact(sigBytes, messageHash(message))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(HashPubKey(tagPubKey(scheme, pubKey)), addr.Payload) {
+		return nil
+	}
+	//旧版本钱包的地址由未补齐的未压缩公钥生成
+	if len(pubKey) == publicKeyLen && bytes.Equal(HashPubKey(unpaddedP256PublicKey(pubKey)), addr.Payload) {
+		return nil
+	}
+	return errors.New("签名与地址不匹配")
+}
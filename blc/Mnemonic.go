@@ -0,0 +1,102 @@
+package blc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"math/big"
+	"strings"
+)
+
+//助记词（参照比特币的BIP39）：将随机熵加上校验位编码为便于抄写的单词序列，再由助记词和可选的密码生成HD钱包的种子
+
+//生成助记词时使用的熵的位数，每32位熵对应1位校验位，每11位对应一个单词，256位熵对应24个单词
+const mnemonicEntropyBits = 256
+
+//由助记词生成种子时PBKDF2的迭代次数
+const mnemonicSeedIterations = 2048
+
+//由助记词生成的种子的长度
+const mnemonicSeedLen = 64
+
+//由助记词生成种子时的盐值前缀，盐值为前缀加上密码
+const mnemonicSaltPrefix = "mnemonic"
+
+//单词表，以及单词在单词表中的索引
+var mnemonicWords = strings.Split(mnemonicWordList, "\n")
+var mnemonicWordIndex = func() map[string]int {
+	index := make(map[string]int)
+	for i, word := range mnemonicWords {
+		index[word] = i
+	}
+	return index
+}()
+
+//生成随机的助记词
+func NewMnemonic() (string, error) {
+	entropy := make([]byte, mnemonicEntropyBits/8)
+	_, err := rand.Read(entropy)
+	if err != nil {
+		return "", err
+	}
+	return entropyToMnemonic(entropy)
+}
+
+//将熵编码为助记词：熵后面加上熵的SHA-256哈希的前(熵的位数/32)位作为校验位，再每11位转换为一个单词
+func entropyToMnemonic(entropy []byte) (string, error) {
+	entropyBits := len(entropy) * 8
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", errors.New("熵的位数必须在128到256之间，并且是32的倍数")
+	}
+	checksumBits := uint(entropyBits / 32)
+	hash := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, checksumBits)
+	bits.Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	wordCount := (entropyBits + int(checksumBits)) / 11
+	words := make([]string, wordCount)
+	mask := big.NewInt(2047)
+	for i := wordCount - 1; i >= 0; i-- {
+		words[i] = mnemonicWords[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+//将助记词解码为熵，并校验单词和校验位
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, errors.New("助记词必须为12、15、18、21或24个单词")
+	}
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := mnemonicWordIndex[word]
+		if !ok {
+			return nil, errors.New("助记词中的单词" + word + "不在单词表中")
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+	checksumBits := uint(len(words) * 11 / 33)
+	checksum := new(big.Int).And(bits, big.NewInt(int64(1)<<checksumBits-1)).Int64()
+	entropy := bits.Rsh(bits, checksumBits).FillBytes(make([]byte, int(checksumBits)*4))
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, errors.New("助记词的校验位错误，请检查是否抄写有误")
+	}
+	return entropy, nil
+}
+
+//校验助记词，并由助记词和密码生成种子，密码可以为空
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	_, err := mnemonicToEntropy(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	return pbkdf2.Key([]byte(normalized), []byte(mnemonicSaltPrefix+passphrase), mnemonicSeedIterations, mnemonicSeedLen, sha512.New), nil
+}
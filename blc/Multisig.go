@@ -0,0 +1,89 @@
+package blc
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+//创建多重签名脚本：OP_m <公钥1> ... <公钥n> OP_n OP_CHECKMULTISIG
+func buildMultisigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if n == 0 || n > maxMultisigKeys {
+		return nil, fmt.Errorf("公钥数量必须在1到%d之间", maxMultisigKeys)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("所需签名数量必须在1到%d之间", n)
+	}
+	sb := &scriptBuilder{}
+	sb.addSmallInt(m)
+	for _, pubKey := range pubKeys {
+		sb.addData(pubKey)
+	}
+	sb.addSmallInt(n).addOp(OP_CHECKMULTISIG)
+	return sb.Script(), nil
+}
+
+//解析多重签名脚本，返回所需签名数量和所有公钥
+func parseMultisigScript(script []byte) (int, [][]byte, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(ops) < 4 || ops[len(ops)-1].Opcode != OP_CHECKMULTISIG {
+		return 0, nil, errors.New("不是多重签名脚本")
+	}
+	m, ok := ops[0].smallInt()
+	if !ok {
+		return 0, nil, errors.New("不是多重签名脚本")
+	}
+	n, ok := ops[len(ops)-2].smallInt()
+	if !ok || n != len(ops)-3 || m < 1 || m > n {
+		return 0, nil, errors.New("不是多重签名脚本")
+	}
+	var pubKeys [][]byte
+	for _, op := range ops[1 : len(ops)-2] {
+		if op.Opcode == OP_0 || !op.isPush() {
+			return 0, nil, errors.New("不是多重签名脚本")
+		}
+		pubKeys = append(pubKeys, op.Data)
+	}
+	return m, pubKeys, nil
+}
+
+//创建m-of-n多重签名地址
+func NewMultisigAddress(m int, pubKeys [][]byte) (string, error) {
+	script, err := buildMultisigScript(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	return string(encodeAddress(activeNetParams.MultisigAddrID, script)), nil
+}
+
+//由收集到的签名生成多重签名输入的解锁脚本，sigs的key为签名者公钥的十六进制字符串
+func buildMultisigScriptSig(script []byte, sigs map[string][]byte, payToScriptHash bool) ([]byte, error) {
+	m, pubKeys, err := parseMultisigScript(script)
+	if err != nil {
+		return nil, err
+	}
+	//签名必须按照多重签名脚本中公钥的顺序排列
+	sb := &scriptBuilder{}
+	count := 0
+	for _, pubKey := range pubKeys {
+		if count == m {
+			break
+		}
+		if sig, ok := sigs[hex.EncodeToString(pubKey)]; ok {
+			sb.addData(sig)
+			count++
+		}
+	}
+	if count < m {
+		return nil, fmt.Errorf("签名数量不足，需要%d个，已有%d个", m, count)
+	}
+	//P2SH的解锁脚本最后需要附上赎回脚本
+	if payToScriptHash {
+		sb.addData(script)
+	}
+	return sb.Script(), nil
+}
@@ -0,0 +1,224 @@
+package blc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+//部分签名交易：包含未签名的交易，以及签名和验证所需的每个输入所引用的输出，
+//可以在只有钱包文件的离线机器上签名，多个钱包的签名可以合并，签名完成后再广播
+
+//部分签名交易中每个输入的信息
+type partialTxInput struct {
+	//所引用的输出
+	PrevOutput *TxOutput
+	//花费P2SH输出时的赎回脚本
+	RedeemScript []byte
+	//已收集到的签名，key为签名者公钥的十六进制字符串
+	Signatures map[string][]byte
+}
+
+//部分签名交易
+type PartialTx struct {
+	//未签名的交易
+	Tx *transaction
+	//与交易中的输入一一对应
+	Inputs []*partialTxInput
+}
+
+//创建部分签名交易，从P2SH地址转出时需要提供赎回脚本
+func NewPartialTx(from string, redeemScript []byte, tos map[string]float64, opts TxOptions, bc *blockChain) (*PartialTx, error) {
+	addr, err := ParseAddress(from)
+	if err != nil {
+		return nil, errors.New("汇款人" + err.Error())
+	}
+	if addr.Version == activeNetParams.ScriptHashAddrID {
+		if !bytes.Equal(HashPubKey(redeemScript), addr.Payload) {
+			return nil, errors.New("赎回脚本与P2SH地址不匹配")
+		}
+	} else {
+		redeemScript = nil
+	}
+	//公钥哈希输入的公钥在签名完成后由签名者的公钥补充
+	tx := newUnsignedTransaction(from, nil, tos, opts, bc)
+	ptx := &PartialTx{Tx: tx}
+	for _, input := range tx.TxInputs {
+		prevTx, err := bc.FindTransaction(input.TXHash)
+		if err != nil {
+			return nil, err
+		}
+		ptx.Inputs = append(ptx.Inputs, &partialTxInput{prevTx.TxOutputs[input.Vout], redeemScript, make(map[string][]byte)})
+	}
+	return ptx, nil
+}
+
+//返回第inID个输入签名时使用的锁定数据：公钥哈希输出为公钥哈希，P2SH输出为赎回脚本，其他脚本输出为锁定脚本
+func (ptx *PartialTx) lockingBytes(inID int) ([]byte, error) {
+	in := ptx.Inputs[inID]
+	if hash, ok := extractScriptHash(in.PrevOutput.ScriptPubKey); ok {
+		if !bytes.Equal(HashPubKey(in.RedeemScript), hash) {
+			return nil, fmt.Errorf("第%d个输入缺少赎回脚本", inID+1)
+		}
+		return in.RedeemScript, nil
+	}
+	return in.PrevOutput.lockingBytes(), nil
+}
+
+//判断公钥能否对第inID个输入签名
+func (ptx *PartialTx) canSign(inID int, pubKey []byte) bool {
+	in := ptx.Inputs[inID]
+	if len(in.PrevOutput.ScriptPubKey) == 0 {
+		return bytes.Equal(HashPubKey(pubKey), in.PrevOutput.Ripemd160Hash)
+	}
+	script, err := ptx.lockingBytes(inID)
+	if err != nil {
+		return false
+	}
+	_, pubKeys, err := parseMultisigScript(script)
+	if err != nil {
+		return false
+	}
+	for _, key := range pubKeys {
+		if bytes.Equal(key, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+//用钱包的私钥对所有可以签名的输入进行签名，返回签名的输入数量
+func (ptx *PartialTx) Sign(wallet *Wallet) (int, error) {
+	count := 0
+	pubKeyHex := hex.EncodeToString(wallet.addressPubKey())
+	for inID, in := range ptx.Inputs {
+		if !ptx.canSign(inID, wallet.addressPubKey()) {
+			continue
+		}
+		if wallet.isLocked() {
+			return 0, errWalletLocked
+		}
+		lockingBytes, err := ptx.lockingBytes(inID)
+		if err != nil {
+			return 0, err
+		}
+		in.Signatures[pubKeyHex] = wallet.sign(ptx.Tx.signatureHash(inID, lockingBytes, in.PrevOutput.Value))
+		count++
+	}
+	return count, nil
+}
+
+//合并另一个部分签名交易中的签名，两个交易必须是同一个未签名的交易
+func (ptx *PartialTx) Combine(other *PartialTx) error {
+	txCopy, otherCopy := ptx.Tx.TrimmedCopy(), other.Tx.TrimmedCopy()
+	if !bytes.Equal(txCopy.Hash(), otherCopy.Hash()) || len(ptx.Inputs) != len(other.Inputs) {
+		return errors.New("不能合并不同交易的签名")
+	}
+	for inID, in := range other.Inputs {
+		for pubKeyHex, sig := range in.Signatures {
+			ptx.Inputs[inID].Signatures[pubKeyHex] = sig
+		}
+	}
+	return nil
+}
+
+//返回输入总金额和输出总金额
+func (ptx *PartialTx) Amounts() (float64, float64) {
+	var inputTotal, outputTotal float64
+	for _, in := range ptx.Inputs {
+		inputTotal += in.PrevOutput.Value
+	}
+	for _, output := range ptx.Tx.TxOutputs {
+		outputTotal += output.Value
+	}
+	return inputTotal, outputTotal
+}
+
+//签名完成后生成可以广播的交易，并用所引用的输出验证签名
+func (ptx *PartialTx) Finalize() (*transaction, error) {
+	tx := *ptx.Tx
+	tx.TxInputs = nil
+	for _, input := range ptx.Tx.TxInputs {
+		in := *input
+		tx.TxInputs = append(tx.TxInputs, &in)
+	}
+	//先补充公钥哈希输入的公钥，公钥会影响交易的哈希值，但不影响签名
+	sigs := make([][]byte, len(tx.TxInputs))
+	for inID, in := range ptx.Inputs {
+		if len(in.PrevOutput.ScriptPubKey) > 0 {
+			continue
+		}
+		for pubKeyHex, sig := range in.Signatures {
+			pubKey, err := hex.DecodeString(pubKeyHex)
+			if err == nil && bytes.Equal(HashPubKey(pubKey), in.PrevOutput.Ripemd160Hash) {
+				tx.TxInputs[inID].PubKey = pubKey
+				sigs[inID] = sig
+				break
+			}
+		}
+		if sigs[inID] == nil {
+			return nil, fmt.Errorf("第%d个输入还没有签名", inID+1)
+		}
+	}
+	tx.TxHash = tx.hashTransaction()
+	for inID, in := range ptx.Inputs {
+		if sigs[inID] != nil {
+			tx.TxInputs[inID].Signature = sigs[inID]
+			continue
+		}
+		script, err := ptx.lockingBytes(inID)
+		if err != nil {
+			return nil, err
+		}
+		scriptSig, err := buildMultisigScriptSig(script, in.Signatures, in.RedeemScript != nil)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个输入：%v", inID+1, err)
+		}
+		tx.TxInputs[inID].ScriptSig = scriptSig
+	}
+	var prevOutputs []*TxOutput
+	for _, in := range ptx.Inputs {
+		prevOutputs = append(prevOutputs, in.PrevOutput)
+	}
+	if !tx.verifyWithOutputs(prevOutputs) {
+		return nil, errors.New("交易签名验证失败")
+	}
+	return &tx, nil
+}
+
+//将部分签名交易保存到文件
+func (ptx *PartialTx) SaveToFile(fileName string) error {
+	var content bytes.Buffer
+	encoder := gob.NewEncoder(&content)
+	err := encoder.Encode(ptx)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content.Bytes(), 0644)
+}
+
+//从文件中读取部分签名交易
+func LoadPartialTx(fileName string) (*PartialTx, error) {
+	fileContent, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var ptx PartialTx
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	err = decoder.Decode(&ptx)
+	if err != nil {
+		return nil, err
+	}
+	if ptx.Tx == nil || len(ptx.Inputs) != len(ptx.Tx.TxInputs) {
+		return nil, errors.New("部分签名交易的格式错误")
+	}
+	for _, in := range ptx.Inputs {
+		if in.Signatures == nil {
+			in.Signatures = make(map[string][]byte)
+		}
+	}
+	return &ptx, nil
+}
@@ -0,0 +1,110 @@
+package blc
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+//2-of-3 P2SH多重签名地址的转出：两个钱包分别签名，合并后打包
+func TestPartialTxMultisig(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	minerAddr := string(miner.GetAddress())
+	signers := []*Wallet{newTestWallet(t, 2, KeyTypeP256), newTestWallet(t, 3, KeyTypeSecp256k1), newTestWallet(t, 4, KeyTypeSchnorr)}
+	var pubKeys [][]byte
+	for _, signer := range signers {
+		pubKeys = append(pubKeys, signer.PublicKey)
+	}
+	redeemScript, err := buildMultisigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multisigAddr := ScriptHashAddress(redeemScript)
+	bc := newTestChain(t, miner)
+	fund := newTestTransaction(t, bc, miner, map[string]float64{multisigAddr: 5}, TxOptions{})
+	if err := bc.AddBlock(minerAddr, []*transaction{fund}); err != nil {
+		t.Fatal(err)
+	}
+
+	ptx, err := NewPartialTx(multisigAddr, redeemScript, map[string]float64{minerAddr: 2}, TxOptions{}, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(t.TempDir(), "multisig.ptx")
+	if err := ptx.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	//每个签名者读取同一个文件，在各自的机器上签名
+	var signed []*PartialTx
+	for _, signer := range signers[1:] {
+		copied, err := LoadPartialTx(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := copied.Sign(signer); err != nil || n != 1 {
+			t.Fatalf("签名了%d个输入：%v", n, err)
+		}
+		signed = append(signed, copied)
+	}
+	if _, err := signed[0].Finalize(); err == nil {
+		t.Fatal("只有一个签名时交易已完成")
+	}
+	if err := signed[0].Combine(signed[1]); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := signed[0].Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(minerAddr, []*transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bc.GetBalance(multisigAddr); balance > 3 || balance <= 0 {
+		t.Fatalf("多重签名地址的找零为%f", balance)
+	}
+}
+
+//签名哈希包含所花费的金额，部分签名交易中的金额被篡改时，签名不能花费真实的输出
+func TestPartialTxSignatureCoversAmount(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	minerAddr := string(miner.GetAddress())
+	cold := newTestWallet(t, 2, KeyTypeSecp256k1)
+	coldAddr := string(cold.GetAddress())
+	bc := newTestChain(t, miner)
+	fund := newTestTransaction(t, bc, miner, map[string]float64{coldAddr: 5}, TxOptions{})
+	if err := bc.AddBlock(minerAddr, []*transaction{fund}); err != nil {
+		t.Fatal(err)
+	}
+
+	//只读钱包创建的交易中没有公钥，由离线钱包签名时补充
+	ptx, err := NewWatchOnlyTransaction(coldAddr, map[string]float64{minerAddr: 1}, TxOptions{}, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	real := ptx.Inputs[0].PrevOutput
+	//离线钱包看到的输入金额被改小，手续费看起来比实际少
+	tampered := *real
+	tampered.Value = real.Value - 3
+	ptx.Inputs[0].PrevOutput = &tampered
+	if _, err := ptx.Sign(cold); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := ptx.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(minerAddr, []*transaction{tx}); err == nil {
+		t.Fatal("对错误金额的签名被接受")
+	}
+
+	ptx.Inputs[0].PrevOutput = real
+	if _, err := ptx.Sign(cold); err != nil {
+		t.Fatal(err)
+	}
+	tx, err = ptx.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(minerAddr, []*transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,10 +7,6 @@ import (
 	"math/big"
 )
 
-//难度系数，表示生成的256位的哈希值的前面至少要有多少个零。
-//这里的 targetBits 为16，表示生成的256位的哈希值的前面至少要有16个零。
-const targetBits = 10
-
 //工作量证明结构
 type proofOfWork struct {
 	//当前要验证的区块
@@ -74,8 +70,8 @@ func (pow *proofOfWork) Run() ([]byte, int64) {
 func NewProofOfWork(b *Block) *proofOfWork {
 	//1、创建一个初始值为1的target
 	target := big.NewInt(1)
-	//2、将target左移 256-targetBits 位
-	target = target.Lsh(target, 256-targetBits)
+	//2、将target左移 256-TargetBits 位，难度系数由当前网络的参数决定
+	target = target.Lsh(target, 256-activeNetParams.TargetBits)
 	//3、创建工作量证明类型并返回
 	return &proofOfWork{b, target}
 }
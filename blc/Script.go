@@ -0,0 +1,540 @@
+package blc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+//脚本操作码，取值与比特币脚本保持一致
+const (
+	OP_0             = byte(0x00)
+	OP_PUSHDATA1     = byte(0x4c)
+	OP_PUSHDATA2     = byte(0x4d)
+	OP_1             = byte(0x51)
+	OP_16            = byte(0x60)
+	OP_IF            = byte(0x63)
+	OP_ELSE          = byte(0x67)
+	OP_ENDIF         = byte(0x68)
+	OP_VERIFY        = byte(0x69)
+	OP_RETURN        = byte(0x6a)
+	OP_DROP          = byte(0x75)
+	OP_DUP           = byte(0x76)
+	OP_SIZE          = byte(0x82)
+	OP_EQUAL         = byte(0x87)
+	OP_EQUALVERIFY   = byte(0x88)
+	OP_SHA256        = byte(0xa8)
+	OP_HASH160       = byte(0xa9)
+	OP_CHECKSIG      = byte(0xac)
+	OP_CHECKMULTISIG = byte(0xae)
+
+	OP_CHECKLOCKTIMEVERIFY = byte(0xb1)
+)
+
+//多重签名中允许的最大公钥数量
+const maxMultisigKeys = 16
+
+//解析后的脚本指令
+type scriptOp struct {
+	//操作码
+	Opcode byte
+	//压栈的数据，只有数据压栈指令才有值
+	Data []byte
+}
+
+//脚本构造器
+type scriptBuilder struct {
+	script []byte
+}
+
+//添加操作码
+func (sb *scriptBuilder) addOp(opcode byte) *scriptBuilder {
+	sb.script = append(sb.script, opcode)
+	return sb
+}
+
+//添加压栈数据，根据数据长度选择不同的压栈指令
+func (sb *scriptBuilder) addData(data []byte) *scriptBuilder {
+	dataLen := len(data)
+	switch {
+	case dataLen < int(OP_PUSHDATA1):
+		sb.script = append(sb.script, byte(dataLen))
+	case dataLen <= 0xff:
+		sb.script = append(sb.script, OP_PUSHDATA1, byte(dataLen))
+	default:
+		lenBytes := make([]byte, 2)
+		binary.LittleEndian.PutUint16(lenBytes, uint16(dataLen))
+		sb.script = append(sb.script, OP_PUSHDATA2)
+		sb.script = append(sb.script, lenBytes...)
+	}
+	sb.script = append(sb.script, data...)
+	return sb
+}
+
+//添加1到16之间的小整数
+func (sb *scriptBuilder) addSmallInt(n int) *scriptBuilder {
+	if n == 0 {
+		return sb.addOp(OP_0)
+	}
+	return sb.addOp(OP_1 + byte(n-1))
+}
+
+//添加整数，1到16之间的小整数使用对应的操作码，其他整数作为数据压栈
+func (sb *scriptBuilder) addInt(n int64) *scriptBuilder {
+	if n >= 0 && n <= 16 {
+		return sb.addSmallInt(int(n))
+	}
+	return sb.addData(intToScriptNum(int(n)))
+}
+
+//返回构造好的脚本
+func (sb *scriptBuilder) Script() []byte {
+	return sb.script
+}
+
+//将脚本解析为指令数组
+func parseScript(script []byte) ([]scriptOp, error) {
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+		var dataLen int
+		switch {
+		case opcode > OP_0 && opcode < OP_PUSHDATA1:
+			dataLen = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, errors.New("脚本格式错误：OP_PUSHDATA1缺少长度")
+			}
+			dataLen = int(script[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, errors.New("脚本格式错误：OP_PUSHDATA2缺少长度")
+			}
+			dataLen = int(binary.LittleEndian.Uint16(script[i : i+2]))
+			i += 2
+		default:
+			ops = append(ops, scriptOp{Opcode: opcode})
+			continue
+		}
+		if i+dataLen > len(script) {
+			return nil, errors.New("脚本格式错误：压栈数据长度越界")
+		}
+		ops = append(ops, scriptOp{Opcode: opcode, Data: script[i : i+dataLen]})
+		i += dataLen
+	}
+	return ops, nil
+}
+
+//判断是否为数据压栈指令
+func (op *scriptOp) isPush() bool {
+	return op.Opcode <= OP_PUSHDATA2
+}
+
+//判断是否为小整数指令，并返回其值
+func (op *scriptOp) smallInt() (int, bool) {
+	if op.Opcode == OP_0 {
+		return 0, true
+	}
+	if op.Opcode >= OP_1 && op.Opcode <= OP_16 {
+		return int(op.Opcode-OP_1) + 1, true
+	}
+	return 0, false
+}
+
+//脚本执行引擎
+type scriptEngine struct {
+	//当前验证的交易
+	tx *transaction
+	//当前验证的输入的索引
+	inputIndex int
+	//计算签名哈希时使用的锁定脚本
+	subScript []byte
+	//当前验证的输入所花费的金额
+	amount float64
+	//数据栈
+	stack [][]byte
+	//条件栈，记录每一层OP_IF分支是否需要执行
+	condStack []bool
+}
+
+//创建脚本执行引擎
+func newScriptEngine(tx *transaction, inputIndex int, subScript []byte, amount float64) *scriptEngine {
+	return &scriptEngine{tx: tx, inputIndex: inputIndex, subScript: subScript, amount: amount}
+}
+
+//依次执行解锁脚本和锁定脚本，执行完成后栈顶为真则验证通过，amount为所花费的输出的金额
+func verifyScript(tx *transaction, inputIndex int, scriptSig, scriptPubKey []byte, amount float64) error {
+	vm := newScriptEngine(tx, inputIndex, scriptPubKey, amount)
+	//解锁脚本只能包含数据压栈指令
+	ops, err := parseScript(scriptSig)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if _, ok := op.smallInt(); !op.isPush() && !ok {
+			return errors.New("解锁脚本只能包含压栈指令")
+		}
+	}
+	if err := vm.execute(scriptSig); err != nil {
+		return err
+	}
+	//保存解锁脚本执行后的栈，用于执行P2SH的赎回脚本
+	stackCopy := append([][]byte{}, vm.stack...)
+	if err := vm.execute(scriptPubKey); err != nil {
+		return err
+	}
+	if err := vm.checkResult(); err != nil {
+		return err
+	}
+	if _, ok := extractScriptHash(scriptPubKey); !ok {
+		return nil
+	}
+	//P2SH：解锁脚本中的最后一个数据为赎回脚本，上面已经校验了赎回脚本的哈希值，接下来执行赎回脚本
+	if len(stackCopy) == 0 {
+		return errors.New("解锁脚本中缺少赎回脚本")
+	}
+	redeemScript := stackCopy[len(stackCopy)-1]
+	vm = newScriptEngine(tx, inputIndex, redeemScript, amount)
+	vm.stack = stackCopy[:len(stackCopy)-1]
+	if err := vm.execute(redeemScript); err != nil {
+		return err
+	}
+	return vm.checkResult()
+}
+
+//判断脚本执行完成后栈顶是否为真
+func (vm *scriptEngine) checkResult() error {
+	if len(vm.stack) == 0 || !castToBool(vm.stack[len(vm.stack)-1]) {
+		return errors.New("脚本执行结果为假")
+	}
+	return nil
+}
+
+//创建P2SH锁定脚本：OP_HASH160 <赎回脚本的哈希值> OP_EQUAL
+func buildScriptHashScript(scriptHash []byte) []byte {
+	sb := &scriptBuilder{}
+	sb.addOp(OP_HASH160).addData(scriptHash).addOp(OP_EQUAL)
+	return sb.Script()
+}
+
+//判断是否为P2SH锁定脚本，并返回其中的赎回脚本的哈希值
+func extractScriptHash(script []byte) ([]byte, bool) {
+	if len(script) != 23 || script[0] != OP_HASH160 || script[1] != 20 || script[22] != OP_EQUAL {
+		return nil, false
+	}
+	return script[2:22], true
+}
+
+//执行脚本
+func (vm *scriptEngine) execute(script []byte) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+	vm.condStack = nil
+	for _, op := range ops {
+		//条件分支指令无论当前分支是否执行都需要处理
+		switch op.Opcode {
+		case OP_IF:
+			cond := false
+			if vm.isExecuting() {
+				top, err := vm.pop()
+				if err != nil {
+					return err
+				}
+				cond = castToBool(top)
+			}
+			vm.condStack = append(vm.condStack, cond)
+			continue
+		case OP_ELSE:
+			if len(vm.condStack) == 0 {
+				return errors.New("OP_ELSE缺少对应的OP_IF")
+			}
+			vm.condStack[len(vm.condStack)-1] = !vm.condStack[len(vm.condStack)-1]
+			continue
+		case OP_ENDIF:
+			if len(vm.condStack) == 0 {
+				return errors.New("OP_ENDIF缺少对应的OP_IF")
+			}
+			vm.condStack = vm.condStack[:len(vm.condStack)-1]
+			continue
+		}
+		if !vm.isExecuting() {
+			continue
+		}
+		if err := vm.step(op); err != nil {
+			return err
+		}
+	}
+	if len(vm.condStack) != 0 {
+		return errors.New("OP_IF缺少对应的OP_ENDIF")
+	}
+	return nil
+}
+
+//判断当前所在的条件分支是否需要执行
+func (vm *scriptEngine) isExecuting() bool {
+	for _, cond := range vm.condStack {
+		if !cond {
+			return false
+		}
+	}
+	return true
+}
+
+//执行单条指令
+func (vm *scriptEngine) step(op scriptOp) error {
+	if op.isPush() && op.Opcode != OP_0 {
+		vm.push(op.Data)
+		return nil
+	}
+	if n, ok := op.smallInt(); ok {
+		vm.push(intToScriptNum(n))
+		return nil
+	}
+	switch op.Opcode {
+	case OP_VERIFY:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if !castToBool(top) {
+			return errors.New("OP_VERIFY验证失败")
+		}
+	case OP_RETURN:
+		return errors.New("OP_RETURN：该输出不可花费")
+	case OP_DROP:
+		if _, err := vm.pop(); err != nil {
+			return err
+		}
+	case OP_DUP:
+		top, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		vm.push(top)
+	case OP_SIZE:
+		top, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		vm.push(intToScriptNum(len(top)))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if op.Opcode == OP_EQUALVERIFY {
+			if !equal {
+				return errors.New("OP_EQUALVERIFY验证失败")
+			}
+			return nil
+		}
+		vm.push(boolToScriptNum(equal))
+	case OP_SHA256:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(top)
+		vm.push(hash[:])
+	case OP_HASH160:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(HashPubKey(top))
+	case OP_CHECKSIG:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(boolToScriptNum(vm.checkSig(sig, pubKey)))
+	case OP_CHECKMULTISIG:
+		return vm.checkMultisig()
+	case OP_CHECKLOCKTIMEVERIFY:
+		return vm.checkLockTimeVerify()
+	default:
+		return fmt.Errorf("不支持的操作码：0x%02x", op.Opcode)
+	}
+	return nil
+}
+
+//校验签名是否为当前输入的有效签名
+func (vm *scriptEngine) checkSig(sig, pubKey []byte) bool {
+	hash := vm.tx.signatureHash(vm.inputIndex, vm.subScript, vm.amount)
+	return verifySignature(pubKey, hash, sig)
+}
+
+//校验交易的锁定时间不早于栈顶的锁定时间，栈顶元素保持不变
+func (vm *scriptEngine) checkLockTimeVerify() error {
+	top, err := vm.peek()
+	if err != nil {
+		return err
+	}
+	lockTime := scriptNumToInt(top)
+	if lockTime < 0 {
+		return errors.New("OP_CHECKLOCKTIMEVERIFY的锁定时间不能为负数")
+	}
+	//锁定时间的类型（区块高度或时间戳）必须一致
+	if (lockTime < lockTimeThreshold) != (vm.tx.LockTime < lockTimeThreshold) {
+		return errors.New("OP_CHECKLOCKTIMEVERIFY的锁定时间类型与交易不一致")
+	}
+	if vm.tx.LockTime < lockTime {
+		return fmt.Errorf("交易的锁定时间%d早于脚本要求的锁定时间%d", vm.tx.LockTime, lockTime)
+	}
+	return nil
+}
+
+//多重签名验证：栈中依次为 签名1...签名m m 公钥1...公钥n n，签名必须按照公钥的顺序排列
+func (vm *scriptEngine) checkMultisig() error {
+	n, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > maxMultisigKeys {
+		return errors.New("多重签名的公钥数量无效")
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return err
+		}
+	}
+	m, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+	if m < 0 || m > n {
+		return errors.New("多重签名的签名数量无效")
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return err
+		}
+	}
+	//每个签名只能与排在上一个匹配公钥之后的公钥进行匹配
+	keyIndex := 0
+	for _, sig := range sigs {
+		for keyIndex < n && !vm.checkSig(sig, pubKeys[keyIndex]) {
+			keyIndex++
+		}
+		if keyIndex == n {
+			vm.push(boolToScriptNum(false))
+			return nil
+		}
+		keyIndex++
+	}
+	vm.push(boolToScriptNum(true))
+	return nil
+}
+
+//压栈
+func (vm *scriptEngine) push(data []byte) {
+	vm.stack = append(vm.stack, data)
+}
+
+//出栈
+func (vm *scriptEngine) pop() ([]byte, error) {
+	top, err := vm.peek()
+	if err != nil {
+		return nil, err
+	}
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+//查看栈顶元素
+func (vm *scriptEngine) peek() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, errors.New("脚本执行失败：栈为空")
+	}
+	return vm.stack[len(vm.stack)-1], nil
+}
+
+//出栈并转换为整数
+func (vm *scriptEngine) popInt() (int, error) {
+	top, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return int(scriptNumToInt(top)), nil
+}
+
+//将整数编码为脚本中的数字（小端序，最高位为符号位）
+func intToScriptNum(n int) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var result []byte
+	for n > 0 {
+		result = append(result, byte(n&0xff))
+		n >>= 8
+	}
+	if result[len(result)-1]&0x80 != 0 {
+		if negative {
+			result = append(result, 0x80)
+		} else {
+			result = append(result, 0x00)
+		}
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+	return result
+}
+
+//将脚本中的数字解码为整数
+func scriptNumToInt(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << uint(8*i)
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		return -result
+	}
+	return result
+}
+
+//将布尔值编码为脚本中的数字
+func boolToScriptNum(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+//判断栈元素是否为真，全零（包括负零）为假
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			//负零
+			if i == len(data)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
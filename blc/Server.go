@@ -5,7 +5,6 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
-	"github.com/boltdb/bolt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -16,7 +15,8 @@ import (
 //第二个终端：端口为3001，钱包节点
 //第三个终端：端口为3002，矿工节点
 
-var knowNodes = []string{"localhost:3000"}
+//已知的节点，启动服务器时为当前网络的种子节点
+var knowNodes []string
 var nodeAddress string //全局变量，节点地址
 // 存储hash值
 var transactionArray [][]byte
@@ -56,16 +56,17 @@ type GetBlocks struct {
 }
 
 func startServer(nodeID string, minerAdd string) {
-	// 当前节点的IP地址
-	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+	// 当前节点的地址，其他节点通过该地址连接当前节点
+	nodeAddress = cfg.externalAddr()
+	knowNodes = cfg.seeds()
 	minerAddress = minerAdd
-	ln, err := net.Listen(PROTOCOL, nodeAddress)
+	ln, err := net.Listen(PROTOCOL, cfg.listenAddr())
 	if err != nil {
 		log.Panic(err)
 	}
 	defer ln.Close()
 	bc := GetBlockChain(nodeID)
-	defer bc.Db.Close()
+	defer bc.Close()
 	//第一个终端：端口为3000，主节点
 	//第二个终端：端口为3001，钱包节点
 	//第三个终端：端口为3002，矿工节点
@@ -90,6 +91,12 @@ func handleConnection(conn net.Conn, bc *blockChain) {
 	if err != nil {
 		log.Panic(err)
 	}
+	//丢弃其他网络的消息，去掉网络魔数后为 12字节的命令 + 结构体序列化的字节数组
+	if len(request) < len(activeNetParams.Magic)+COMMANDLENGTH || !bytes.Equal(request[:len(activeNetParams.Magic)], activeNetParams.Magic[:]) {
+		log.Printf("丢弃来自%s的消息：网络魔数与%s不匹配", conn.RemoteAddr(), activeNetParams.Name)
+		return
+	}
+	request = request[len(activeNetParams.Magic):]
 	fmt.Printf("Receive a Message:%s\n", request[:COMMANDLENGTH])
 	//version
 	command := BytesToCommand(request[:COMMANDLENGTH])
@@ -166,8 +173,8 @@ func handleGetblocks(request []byte, bc *blockChain) {
 	if err != nil {
 		log.Panic(err)
 	}
-	blocks := bc.GetBlockHashes()
-	//主节点将自己的所有的区块hash发送给钱包节点
+	blocks := bc.GetBlockHashes(0, bc.GetBestHeight())
+	//主节点将自己的所有的区块hash按高度从低到高发送给钱包节点，钱包节点按顺序连接区块
 	sendInv(payload.AddrFrom, BLOCK_TYPE, blocks)
 }
 
@@ -210,10 +217,12 @@ func handleBlock(request []byte, bc *blockChain) {
 	blockBytes := payload.Block
 	block := Deserialize(blockBytes)
 	//将当前区块添加到区块链中
-	bc.AddBlockToBlockchain(block)
-	//更新UTXO池
-	UTXOSet := &UTXOSet{bc}
-	UTXOSet.UpdateUTXOSet(block.Txs)
+	err = bc.AddBlockToBlockchain(block)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	//UTXO池和钱包账本已经在添加区块的事务中由SetTip更新，不在最长链上的区块不影响它们
 	if len(transactionArray) > 0 {
 		blockHash := transactionArray[0]
 		sendGetData(payload.AddrFrom, "block", blockHash)
@@ -237,6 +246,11 @@ func handleTx(request []byte, bc *blockChain) {
 		log.Panic(err)
 	}
 	tx := payload.Tx
+	//数据输出超过本节点datacarriersize的交易不放入交易池，也不转发
+	if err := tx.checkDataOutputs(MaxDataCarrierSize); err != nil {
+		log.Println(err)
+		return
+	}
 	memoryTxPool[hex.EncodeToString(tx.TxHash)] = tx
 	// 说明主节点自己
 	if nodeAddress == knowNodes[0] {
@@ -249,47 +263,17 @@ func handleTx(request []byte, bc *blockChain) {
 	}
 	// 矿工进行挖矿验证
 	if len(minerAddress) > 0 {
-		utxoSet := &UTXOSet{bc}
-		txs := []*transaction{tx}
-		//奖励
-		coinbaseTx := NewCoinbaseTransaction(minerAddress)
-		txs = append(txs, coinbaseTx)
-		_txs := []*transaction{}
-		//fmt.Println("开始进行数字签名验证.....")
-		for _, tx := range txs {
-			//fmt.Printf("开始第%d次验证...\n",index)
-			// 作业，数字签名失败
-			if bc.VerifyTransaction(tx) != true {
-				log.Panic("ERROR: Invalid transaction")
-			}
-			//fmt.Printf("第%d次验证成功\n",index)
-			_txs = append(_txs, tx)
+		//未到锁定时间的交易暂时留在交易池中
+		if err := bc.checkTransactionLocks(tx, bc.GetBestHeight()+1, bc.Tip); err != nil {
+			log.Println(err)
+			return
+		}
+		//验证交易并打包到新的区块中，区块、最新区块、UTXO池和钱包账本在同一个事务中更新
+		block, err := bc.mineBlock(minerAddress, []*transaction{tx})
+		if err != nil {
+			log.Println(err)
+			return
 		}
-		//fmt.Println("数字签名验证成功.....")
-		//1. 通过相关算法建立Transaction数组
-		var block *Block
-		bc.Db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(tableName))
-			if b != nil {
-				hash := b.Get([]byte("l"))
-				blockBytes := b.Get(hash)
-				block = Deserialize(blockBytes)
-			}
-			return nil
-		})
-		//2. 建立新的区块
-		block = NewBlock(block.Height+1, block.Hash, txs)
-		//将新区块存储到数据库
-		bc.Db.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(tableName))
-			if b != nil {
-				b.Put(block.Hash, block.Serialize())
-				b.Put([]byte("l"), block.Hash)
-				bc.Tip = block.Hash
-			}
-			return nil
-		})
-		utxoSet.UpdateUTXOSet(txs)
 		sendBlock(knowNodes[0], block.Serialize())
 	}
 }
@@ -369,8 +353,8 @@ func sendData(to string, data []byte) {
 		panic("error")
 	}
 	defer conn.Close()
-	// 附带要发送的数据
-	_, err = io.Copy(conn, bytes.NewReader(data))
+	// 附带要发送的数据，以当前网络的魔数开头
+	_, err = io.Copy(conn, bytes.NewReader(append(activeNetParams.Magic[:], data...)))
 	if err != nil {
 		log.Panic(err)
 	}
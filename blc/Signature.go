@@ -0,0 +1,310 @@
+package blc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"math/big"
+)
+
+//P-256 ECDSA数字签名：签名和公钥都使用固定长度的编码，每个整数都填充为32字节，
+//公钥可以是64字节的未压缩公钥x||y，也可以是33字节的压缩公钥（前缀0x02或0x03表示y的奇偶，后面是x），验证签名时再解压，
+//签名时按照RFC 6979由私钥和哈希值确定性地生成随机数k，不依赖随机数生成器，
+//并且只接受s不大于N/2的签名（low-S），防止他人将签名改为(r, N-s)从而修改交易的哈希值
+
+//签名中r、s及公钥中x、y的字节长度
+const sigScalarLen = 32
+
+//签名的字节长度，r和s各32字节
+const signatureLen = 2 * sigScalarLen
+
+//未压缩公钥的字节长度，x和y坐标各32字节
+const publicKeyLen = 2 * sigScalarLen
+
+//压缩公钥的字节长度，1字节的前缀加上x坐标
+const compressedPublicKeyLen = 1 + sigScalarLen
+
+//旧版本的钱包直接拼接x.Bytes()和y.Bytes()作为公钥，x或y有前导0字节时公钥不足64字节，
+//旧版本的地址由这样的公钥生成，验证签名时补齐为64字节；长度不小于该值，与带有类型标签的公钥区分开
+const minLegacyPublicKeyLen = compressedPublicKeyLen + 2
+
+//签名和公钥使用的椭圆曲线
+var sigCurve = elliptic.P256()
+
+//用P-256私钥对哈希值进行签名，返回r||s
+func signP256(privKey ecdsa.PrivateKey, hash []byte) []byte {
+	N := sigCurve.Params().N
+	e := hashToInt(hash)
+	var r, s *big.Int
+	nextNonce := rfc6979Nonces(privKey.D, hash)
+	for {
+		k := nextNonce()
+		x, _ := sigCurve.ScalarBaseMult(k.FillBytes(make([]byte, sigScalarLen)))
+		r = new(big.Int).Mod(x, N)
+		if r.Sign() == 0 {
+			continue
+		}
+		//s = k^-1 * (e + r*d) mod N
+		s = new(big.Int).Mul(r, privKey.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, N))
+		s.Mod(s, N)
+		if s.Sign() != 0 {
+			break
+		}
+	}
+	//(r, s)和(r, N-s)都是有效的签名，统一使用较小的s
+	if s.Cmp(halfOrder()) > 0 {
+		s.Sub(N, s)
+	}
+	signature := make([]byte, signatureLen)
+	r.FillBytes(signature[:sigScalarLen])
+	s.FillBytes(signature[sigScalarLen:])
+	return signature
+}
+
+//用P-256公钥验证哈希值的签名，签名和公钥的长度必须正确，s必须不大于N/2
+func verifyP256(pubKey, hash, signature []byte) bool {
+	if len(signature) != signatureLen {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:sigScalarLen])
+	s := new(big.Int).SetBytes(signature[sigScalarLen:])
+	if s.Cmp(halfOrder()) > 0 {
+		return false
+	}
+	x, y := parseP256PublicKey(pubKey)
+	if x == nil {
+		return false
+	}
+	rawPubKey := ecdsa.PublicKey{Curve: sigCurve, X: x, Y: y}
+	return ecdsa.Verify(&rawPubKey, hash, r, s)
+}
+
+//解析未压缩或压缩的公钥，公钥无效时返回nil
+func parseP256PublicKey(pubKey []byte) (*big.Int, *big.Int) {
+	switch {
+	case len(pubKey) == publicKeyLen:
+		x := new(big.Int).SetBytes(pubKey[:sigScalarLen])
+		y := new(big.Int).SetBytes(pubKey[sigScalarLen:])
+		if !sigCurve.IsOnCurve(x, y) {
+			return nil, nil
+		}
+		return x, y
+	case isCompressedP256PublicKey(pubKey):
+		//解压时会校验点是否在曲线上
+		return elliptic.UnmarshalCompressed(sigCurve, pubKey)
+	case isLegacyP256PublicKey(pubKey):
+		padded := padLegacyP256PublicKey(pubKey)
+		if padded == nil {
+			return nil, nil
+		}
+		return parseP256PublicKey(padded)
+	}
+	return nil, nil
+}
+
+//返回64字节公钥在旧版本钱包中的格式x.Bytes()||y.Bytes()，x和y的前导0字节被去掉
+func unpaddedP256PublicKey(pubKey []byte) []byte {
+	x := new(big.Int).SetBytes(pubKey[:sigScalarLen])
+	y := new(big.Int).SetBytes(pubKey[sigScalarLen:])
+	return append(x.Bytes(), y.Bytes()...)
+}
+
+//判断是否为旧版本钱包中未补齐的公钥
+func isLegacyP256PublicKey(pubKey []byte) bool {
+	return len(pubKey) >= minLegacyPublicKeyLen && len(pubKey) < publicKeyLen
+}
+
+//将未补齐的公钥补齐为64字节的x||y，x和y的分界无法由长度确定，依次尝试每种分法，
+//只有一种分法得到的点在曲线上，都不在曲线上时返回nil
+func padLegacyP256PublicKey(pubKey []byte) []byte {
+	for xLen := len(pubKey) - sigScalarLen; xLen <= sigScalarLen; xLen++ {
+		if xLen < 1 {
+			continue
+		}
+		x := new(big.Int).SetBytes(pubKey[:xLen])
+		y := new(big.Int).SetBytes(pubKey[xLen:])
+		//没有前导0字节的部分不是Bytes()的结果
+		if len(x.Bytes()) != xLen || len(y.Bytes()) != len(pubKey)-xLen || !sigCurve.IsOnCurve(x, y) {
+			continue
+		}
+		return publicKeyBytes(&ecdsa.PublicKey{Curve: sigCurve, X: x, Y: y})
+	}
+	return nil
+}
+
+//判断是否为压缩公钥的格式
+func isCompressedP256PublicKey(pubKey []byte) bool {
+	return len(pubKey) == compressedPublicKeyLen && (pubKey[0] == 0x02 || pubKey[0] == 0x03)
+}
+
+//用私钥中的公钥生成压缩公钥的字节数组，新创建的钱包都使用压缩公钥
+func compressedPublicKeyBytes(publicKey *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(sigCurve, publicKey.X, publicKey.Y)
+}
+
+//用私钥中的公钥生成未压缩公钥的字节数组，x||y，每个坐标都补齐为32字节
+func publicKeyBytes(publicKey *ecdsa.PublicKey) []byte {
+	pubKey := make([]byte, publicKeyLen)
+	publicKey.X.FillBytes(pubKey[:sigScalarLen])
+	publicKey.Y.FillBytes(pubKey[sigScalarLen:])
+	return pubKey
+}
+
+//返回N/2
+func halfOrder() *big.Int {
+	return new(big.Int).Rsh(sigCurve.Params().N, 1)
+}
+
+//将哈希值转换为整数，哈希值比N长时只取前面与N相同的位数（RFC 6979中的bits2int）
+func hashToInt(hash []byte) *big.Int {
+	orderBits := sigCurve.Params().N.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+	e := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - orderBits; excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+	return e
+}
+
+//按照RFC 6979 3.2节由私钥和哈希值生成随机数k的序列，
+//返回的函数每次调用返回下一个在[1, N-1]之间的k，只有r或s为0时才需要下一个k
+func rfc6979Nonces(d *big.Int, hash []byte) func() *big.Int {
+	N := sigCurve.Params().N
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(sha256.New, key)
+		for _, b := range data {
+			h.Write(b)
+		}
+		return h.Sum(nil)
+	}
+	//私钥和哈希值（模N）都编码为与N等长的字节数组
+	x := d.FillBytes(make([]byte, sigScalarLen))
+	h1 := new(big.Int).Mod(hashToInt(hash), N).FillBytes(make([]byte, sigScalarLen))
+	V := make([]byte, sha256.Size)
+	K := make([]byte, sha256.Size)
+	for i := range V {
+		V[i] = 0x01
+	}
+	K = mac(K, V, []byte{0x00}, x, h1)
+	V = mac(K, V)
+	K = mac(K, V, []byte{0x01}, x, h1)
+	V = mac(K, V)
+	first := true
+	return func() *big.Int {
+		for {
+			if !first {
+				K = mac(K, V, []byte{0x00})
+				V = mac(K, V)
+			}
+			first = false
+			V = mac(K, V)
+			k := hashToInt(V)
+			if k.Sign() > 0 && k.Cmp(N) < 0 {
+				return k
+			}
+		}
+	}
+}
+
+//可恢复签名的第一个字节为27加上恢复标识，公钥为压缩公钥时再加4，与比特币相同
+const compactSigHeader = 27
+const compactSigCompressed = 4
+
+//生成可以恢复出公钥的签名：标记(1) r(32) s(32)，恢复标识为R点y坐标的奇偶及x坐标是否大于等于N
+func signCompactP256(privKey ecdsa.PrivateKey, hash []byte, compressed bool) []byte {
+	signature := signP256(privKey, hash)
+	pubKey := publicKeyBytes(&privKey.PublicKey)
+	//恢复标识无法由签名直接得到，依次尝试每个恢复标识，能恢复出自己公钥的就是正确的恢复标识
+	for recID := byte(0); recID < 4; recID++ {
+		x, y, err := recoverP256(signature, hash, recID)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(publicKeyBytes(&ecdsa.PublicKey{Curve: sigCurve, X: x, Y: y}), pubKey) {
+			header := compactSigHeader + recID
+			if compressed {
+				header += compactSigCompressed
+			}
+			return append([]byte{header}, signature...)
+		}
+	}
+	log.Panic("无法生成可恢复的签名")
+	return nil
+}
+
+//由可恢复签名恢复出公钥，返回的公钥是否压缩由签名的标记决定
+func recoverCompactP256(signature, hash []byte) ([]byte, error) {
+	if len(signature) != 1+signatureLen || signature[0] < compactSigHeader || signature[0] >= compactSigHeader+2*compactSigCompressed {
+		return nil, errors.New("签名格式错误")
+	}
+	recID := (signature[0] - compactSigHeader) % compactSigCompressed
+	compressed := signature[0]-compactSigHeader >= compactSigCompressed
+	x, y, err := recoverP256(signature[1:], hash, recID)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := &ecdsa.PublicKey{Curve: sigCurve, X: x, Y: y}
+	var pubKey []byte
+	if compressed {
+		pubKey = compressedPublicKeyBytes(publicKey)
+	} else {
+		pubKey = publicKeyBytes(publicKey)
+	}
+	//恢复出的公钥还需要能验证签名
+	if !verifyP256(pubKey, hash, signature[1:]) {
+		return nil, errors.New("签名验证失败")
+	}
+	return pubKey, nil
+}
+
+//由签名r||s、哈希值和恢复标识恢复出公钥：Q = r^-1 * (s*R - e*G)
+func recoverP256(signature, hash []byte, recID byte) (*big.Int, *big.Int, error) {
+	params := sigCurve.Params()
+	r := new(big.Int).SetBytes(signature[:sigScalarLen])
+	s := new(big.Int).SetBytes(signature[sigScalarLen:])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(params.N) >= 0 || s.Cmp(params.N) >= 0 {
+		return nil, nil, errors.New("签名无效")
+	}
+	//R点的x坐标为r或r+N
+	rx := new(big.Int).Set(r)
+	if recID&2 != 0 {
+		rx.Add(rx, params.N)
+	}
+	if rx.Cmp(params.P) >= 0 {
+		return nil, nil, errors.New("签名无效")
+	}
+	//由y^2 = x^3 - 3x + b求出y，P-256的p模4余3，平方根为(y^2)^((p+1)/4)
+	y2 := new(big.Int).Exp(rx, big.NewInt(3), params.P)
+	threeX := new(big.Int).Mul(rx, big.NewInt(3))
+	y2.Sub(y2, threeX)
+	y2.Add(y2, params.B)
+	y2.Mod(y2, params.P)
+	ry := new(big.Int).Exp(y2, new(big.Int).Rsh(new(big.Int).Add(params.P, big.NewInt(1)), 2), params.P)
+	if new(big.Int).Exp(ry, big.NewInt(2), params.P).Cmp(y2) != 0 {
+		return nil, nil, errors.New("签名无效")
+	}
+	if ry.Bit(0) != uint(recID&1) {
+		ry.Sub(params.P, ry)
+	}
+	//s*R - e*G
+	e := new(big.Int).Mod(hashToInt(hash), params.N)
+	sRx, sRy := sigCurve.ScalarMult(rx, ry, s.Bytes())
+	eGx, eGy := sigCurve.ScalarBaseMult(e.Bytes())
+	eGy.Sub(params.P, eGy)
+	qx, qy := sigCurve.Add(sRx, sRy, eGx, eGy)
+	rInv := new(big.Int).ModInverse(r, params.N)
+	qx, qy = sigCurve.ScalarMult(qx, qy, rInv.Bytes())
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, nil, errors.New("签名无效")
+	}
+	return qx, qy, nil
+}
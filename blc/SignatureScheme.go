@@ -0,0 +1,267 @@
+package blc
+
+import (
+	"bytes"
+	"errors"
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"log"
+	"math/big"
+)
+
+//签名算法：钱包中的每个密钥都有密钥类型，签名和验证签名时根据密钥类型选择签名算法
+//P-256的公钥为64字节的未压缩公钥或33字节的压缩公钥，不带类型标签，与原有的公钥保持一致
+//其他类型的公钥以1字节的类型标签开头，锁定脚本中的公钥同样带有标签，因此验证签名时由公钥就可以确定签名算法
+//公钥哈希输出中记录了密钥类型，不同类型的公钥哈希地址使用不同的版本号
+
+//密钥类型，同时也是公钥的类型标签
+const (
+	//P-256 ECDSA，原有的密钥类型
+	KeyTypeP256 = byte(0x00)
+	//secp256k1 ECDSA，与比特币相同，签名为DER编码
+	KeyTypeSecp256k1 = byte(0x10)
+	//secp256k1 Schnorr签名（参照比特币的BIP340），公钥为32字节的x坐标，签名为64字节
+	KeyTypeSchnorr = byte(0x11)
+)
+
+//签名算法
+type signatureScheme interface {
+	//密钥类型
+	keyType() byte
+	//名称，创建钱包时用于选择密钥类型
+	name() string
+	//公钥哈希地址的版本号
+	addressVersion() byte
+	//私钥是否在有效范围内
+	validPrivateKey(d []byte) bool
+	//由私钥生成公钥，不含类型标签
+	publicKey(d []byte) []byte
+	//用私钥对哈希值进行签名
+	sign(d, hash []byte) []byte
+	//用公钥（不含类型标签）验证哈希值的签名
+	verify(pubKey, hash, signature []byte) bool
+	//生成可以恢复出公钥的签名，compressed表示恢复出的公钥是否为压缩公钥
+	signCompact(d, hash []byte, compressed bool) []byte
+	//由签名和哈希值恢复出公钥（不含类型标签），签名无效时返回错误
+	recoverCompact(signature, hash []byte) ([]byte, error)
+}
+
+//所有签名算法，key为密钥类型
+var signatureSchemes = map[byte]signatureScheme{
+	KeyTypeP256:      p256Scheme{},
+	KeyTypeSecp256k1: secp256k1Scheme{},
+	KeyTypeSchnorr:   schnorrScheme{},
+}
+
+//所有密钥类型，按照固定的顺序遍历签名算法时使用
+var signatureKeyTypes = []byte{KeyTypeP256, KeyTypeSecp256k1, KeyTypeSchnorr}
+
+//根据名称查找签名算法
+func schemeByName(name string) (signatureScheme, error) {
+	for _, keyType := range signatureKeyTypes {
+		scheme := signatureSchemes[keyType]
+		if scheme.name() == name {
+			return scheme, nil
+		}
+	}
+	return nil, errors.New("不支持的密钥类型" + name + "，可选的类型为p256、secp256k1、schnorr")
+}
+
+//根据公钥哈希地址的版本号查找签名算法
+func schemeByAddressVersion(version byte) (signatureScheme, bool) {
+	for _, keyType := range signatureKeyTypes {
+		scheme := signatureSchemes[keyType]
+		if scheme.addressVersion() == version {
+			return scheme, true
+		}
+	}
+	return nil, false
+}
+
+//由带有类型标签的公钥确定签名算法，返回签名算法和不含标签的公钥
+func schemeForPubKey(pubKey []byte) (signatureScheme, []byte, bool) {
+	if len(pubKey) == publicKeyLen || isCompressedP256PublicKey(pubKey) || isLegacyP256PublicKey(pubKey) {
+		return p256Scheme{}, pubKey, true
+	}
+	if len(pubKey) == 0 || pubKey[0] == KeyTypeP256 {
+		return nil, nil, false
+	}
+	scheme, ok := signatureSchemes[pubKey[0]]
+	if !ok {
+		return nil, nil, false
+	}
+	return scheme, pubKey[1:], true
+}
+
+//为公钥加上类型标签，P-256的公钥不加标签
+func tagPubKey(scheme signatureScheme, pubKey []byte) []byte {
+	if scheme.keyType() == KeyTypeP256 {
+		return pubKey
+	}
+	return append([]byte{scheme.keyType()}, pubKey...)
+}
+
+//用带有类型标签的公钥验证哈希值的签名
+func verifySignature(pubKey, hash, signature []byte) bool {
+	scheme, rawPubKey, ok := schemeForPubKey(pubKey)
+	if !ok {
+		return false
+	}
+	return scheme.verify(rawPubKey, hash, signature)
+}
+
+//P-256 ECDSA
+type p256Scheme struct{}
+
+func (p256Scheme) keyType() byte        { return KeyTypeP256 }
+func (p256Scheme) name() string         { return "p256" }
+func (p256Scheme) addressVersion() byte { return activeNetParams.PubKeyHashAddrID }
+
+func (p256Scheme) validPrivateKey(d []byte) bool {
+	k := new(big.Int).SetBytes(d)
+	return len(d) <= 32 && k.Sign() > 0 && k.Cmp(sigCurve.Params().N) < 0
+}
+
+//返回33字节的压缩公钥
+func (p256Scheme) publicKey(d []byte) []byte {
+	privateKey := privateKeyFromBytes(d)
+	return compressedPublicKeyBytes(&privateKey.PublicKey)
+}
+
+func (p256Scheme) sign(d, hash []byte) []byte {
+	return signP256(privateKeyFromBytes(d), hash)
+}
+
+func (p256Scheme) verify(pubKey, hash, signature []byte) bool {
+	return verifyP256(pubKey, hash, signature)
+}
+
+func (p256Scheme) signCompact(d, hash []byte, compressed bool) []byte {
+	return signCompactP256(privateKeyFromBytes(d), hash, compressed)
+}
+
+func (p256Scheme) recoverCompact(signature, hash []byte) ([]byte, error) {
+	return recoverCompactP256(signature, hash)
+}
+
+//secp256k1 ECDSA，签名时使用RFC 6979确定性随机数，签名为low-S的DER编码
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) keyType() byte        { return KeyTypeSecp256k1 }
+func (secp256k1Scheme) name() string         { return "secp256k1" }
+func (secp256k1Scheme) addressVersion() byte { return activeNetParams.Secp256k1AddrID }
+
+func (secp256k1Scheme) validPrivateKey(d []byte) bool {
+	return validSecp256k1PrivateKey(d)
+}
+
+//返回33字节的压缩公钥
+func (secp256k1Scheme) publicKey(d []byte) []byte {
+	privateKey, _ := btcec.PrivKeyFromBytes(d)
+	return privateKey.PubKey().SerializeCompressed()
+}
+
+func (secp256k1Scheme) sign(d, hash []byte) []byte {
+	privateKey, _ := btcec.PrivKeyFromBytes(d)
+	return btcecdsa.Sign(privateKey, hash).Serialize()
+}
+
+func (secp256k1Scheme) verify(pubKey, hash, signature []byte) bool {
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	sig, err := btcecdsa.ParseDERSignature(signature)
+	if err != nil {
+		return false
+	}
+	//重新编码后必须与原签名相同，拒绝s大于N/2及其他非标准编码的签名
+	if !bytes.Equal(sig.Serialize(), signature) {
+		return false
+	}
+	return sig.Verify(hash, key)
+}
+
+//与比特币相同的可恢复签名，签名的标记中记录了公钥是否压缩
+func (secp256k1Scheme) signCompact(d, hash []byte, compressed bool) []byte {
+	privateKey, _ := btcec.PrivKeyFromBytes(d)
+	signature, err := btcecdsa.SignCompact(privateKey, hash, compressed)
+	if err != nil {
+		log.Panic(err)
+	}
+	return signature
+}
+
+//返回的公钥是否压缩由签名的标记决定
+func (secp256k1Scheme) recoverCompact(signature, hash []byte) ([]byte, error) {
+	key, compressed, err := btcecdsa.RecoverCompact(signature, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return key.SerializeUncompressed(), nil
+	}
+	return key.SerializeCompressed(), nil
+}
+
+//secp256k1 Schnorr签名
+type schnorrScheme struct{}
+
+func (schnorrScheme) keyType() byte        { return KeyTypeSchnorr }
+func (schnorrScheme) name() string         { return "schnorr" }
+func (schnorrScheme) addressVersion() byte { return activeNetParams.SchnorrAddrID }
+
+func (schnorrScheme) validPrivateKey(d []byte) bool {
+	return validSecp256k1PrivateKey(d)
+}
+
+//返回32字节的x坐标
+func (schnorrScheme) publicKey(d []byte) []byte {
+	privateKey, _ := btcec.PrivKeyFromBytes(d)
+	return schnorr.SerializePubKey(privateKey.PubKey())
+}
+
+func (schnorrScheme) sign(d, hash []byte) []byte {
+	privateKey, _ := btcec.PrivKeyFromBytes(d)
+	sig, err := schnorr.Sign(privateKey, hash)
+	if err != nil {
+		log.Panic(err)
+	}
+	return sig.Serialize()
+}
+
+func (schnorrScheme) verify(pubKey, hash, signature []byte) bool {
+	key, err := schnorr.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(signature)
+	if err != nil {
+		return false
+	}
+	return sig.Verify(hash, key)
+}
+
+//Schnorr签名不能恢复出公钥，可恢复签名为32字节的公钥加上64字节的签名
+//Schnorr公钥只有32字节的x坐标一种格式，没有压缩与未压缩之分，因此不使用compressed
+func (scheme schnorrScheme) signCompact(d, hash []byte, compressed bool) []byte {
+	return append(scheme.publicKey(d), scheme.sign(d, hash)...)
+}
+
+func (scheme schnorrScheme) recoverCompact(signature, hash []byte) ([]byte, error) {
+	if len(signature) != 32+signatureLen {
+		return nil, errors.New("签名的长度错误")
+	}
+	pubKey := signature[:32]
+	if !scheme.verify(pubKey, hash, signature[32:]) {
+		return nil, errors.New("签名验证失败")
+	}
+	return pubKey, nil
+}
+
+//判断私钥是否在secp256k1的有效范围[1, N-1]内
+func validSecp256k1PrivateKey(d []byte) bool {
+	k := new(big.Int).SetBytes(d)
+	return len(d) <= 32 && k.Sign() > 0 && k.Cmp(btcec.S256().Params().N) < 0
+}
@@ -0,0 +1,59 @@
+package blc
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+)
+
+//找出x坐标以0x00开头的P-256私钥
+func legacyTestKey(t *testing.T) ecdsa.PrivateKey {
+	t.Helper()
+	for i := int64(1); i < 100000; i++ {
+		key := privateKeyFromBytes(big.NewInt(i).FillBytes(make([]byte, sigScalarLen)))
+		if len(key.X.Bytes()) < sigScalarLen && len(key.Y.Bytes()) == sigScalarLen {
+			return key
+		}
+	}
+	t.Fatal("没有找到x坐标以0x00开头的私钥")
+	return ecdsa.PrivateKey{}
+}
+
+//旧版本钱包中未补齐的公钥仍然可以验证签名，地址由未补齐的公钥生成，这样的输出仍然可以花费
+func TestLegacyUnpaddedPublicKey(t *testing.T) {
+	key := legacyTestKey(t)
+	legacy := append(key.X.Bytes(), key.Y.Bytes()...)
+	if len(legacy) >= publicKeyLen {
+		t.Fatalf("公钥长度为%d", len(legacy))
+	}
+	scheme, _, ok := schemeForPubKey(legacy)
+	if !ok || scheme.keyType() != KeyTypeP256 {
+		t.Fatal("未补齐的公钥没有被识别为P-256公钥")
+	}
+	hash := make([]byte, 32)
+	hash[0] = 1
+	if !verifySignature(legacy, hash, signP256(key, hash)) {
+		t.Fatal("未补齐的公钥不能验证签名")
+	}
+	//补齐后的公钥不在曲线上时拒绝
+	broken := append([]byte{}, legacy...)
+	broken[len(broken)-1] ^= 1
+	if parseX, _ := parseP256PublicKey(broken); parseX != nil {
+		t.Fatal("不在曲线上的公钥被接受")
+	}
+
+	//花费旧版本地址的输出：地址中的公钥哈希由未补齐的公钥计算
+	prevOutput := &TxOutput{Value: 1, Ripemd160Hash: HashPubKey(legacy), KeyType: KeyTypeP256}
+	input := &TxInput{TXHash: []byte{1}, Vout: 0, PubKey: legacy}
+	tx := &transaction{[]byte{}, []*TxInput{input}, []*TxOutput{{Value: 1, Ripemd160Hash: HashPubKey(legacy), KeyType: KeyTypeP256}}, 0}
+	tx.TxHash = tx.hashTransaction()
+	input.Signature = signP256(key, tx.signatureHash(0, prevOutput.Ripemd160Hash, prevOutput.Value))
+	if !tx.verifyWithOutputs([]*TxOutput{prevOutput}) {
+		t.Fatal("旧版本地址的输出不能花费")
+	}
+	//补齐后的公钥哈希与地址不同，不能用来花费
+	input.PubKey = publicKeyBytes(&key.PublicKey)
+	if tx.verifyWithOutputs([]*TxOutput{prevOutput}) {
+		t.Fatal("与地址不匹配的公钥被接受")
+	}
+}
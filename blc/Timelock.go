@@ -0,0 +1,101 @@
+package blc
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+//锁定时间的分界值，小于该值时锁定时间表示区块高度，否则表示Unix时间戳
+const lockTimeThreshold = 500000000
+
+//相对锁定时间的编码方式与比特币的BIP68一致：
+//第22位为类型标志，设置时表示以512秒为单位的时间，否则表示区块数；低16位为锁定的值
+const sequenceLockTimeTypeFlag = 1 << 22
+const sequenceLockTimeMask = 0x0000ffff
+const sequenceLockTimeGranularity = 9
+
+//计算中位时间时使用的区块数量
+const medianTimeBlocks = 11
+
+//将区块数编码为相对锁定时间
+func SequenceFromBlocks(blocks int64) int64 {
+	return blocks & sequenceLockTimeMask
+}
+
+//将秒数编码为相对锁定时间，不足512秒的部分向上取整
+func SequenceFromSeconds(seconds int64) int64 {
+	units := (seconds + (1 << sequenceLockTimeGranularity) - 1) >> sequenceLockTimeGranularity
+	return sequenceLockTimeTypeFlag | (units & sequenceLockTimeMask)
+}
+
+//计算以blockHash为最新区块的最近medianTimeBlocks个区块的时间戳中位数
+func (bc *blockChain) medianTimePast(blockHash []byte) int64 {
+	var timestamps []int64
+	var hashInt big.Int
+	iterator := &BlockChainIterator{currHash: blockHash, store: bc.Store}
+	for i := 0; i < medianTimeBlocks; i++ {
+		b := iterator.Next()
+		timestamps = append(timestamps, b.Timestamp)
+		hashInt.SetBytes(b.PrevBlockHash)
+		//如果当前区块的前一个区块的哈希值为0，则认为当前区块已经是创世区块了，跳出循环
+		if hashInt.Cmp(big.NewInt(0)) == 0 {
+			break
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+//校验交易能否被打包到高度为height、前一个区块哈希为prevBlockHash的区块中
+func (bc *blockChain) checkTransactionLocks(tx *transaction, height int64, prevBlockHash []byte) error {
+	if tx.isCoinbase() {
+		return nil
+	}
+	medianTime := bc.medianTimePast(prevBlockHash)
+	//绝对锁定时间
+	if tx.LockTime > 0 {
+		if tx.LockTime < lockTimeThreshold && height < tx.LockTime {
+			return fmt.Errorf("交易%x锁定到区块高度%d，当前区块高度为%d", tx.TxHash, tx.LockTime, height)
+		}
+		if tx.LockTime >= lockTimeThreshold && medianTime < tx.LockTime {
+			return fmt.Errorf("交易%x锁定到时间%d，当前中位时间为%d", tx.TxHash, tx.LockTime, medianTime)
+		}
+	}
+	//每个输入的相对锁定时间，从所引用的输出被打包的区块开始计算
+	for _, input := range tx.TxInputs {
+		if input.Sequence == 0 {
+			continue
+		}
+		//从被校验的区块的前一个区块开始查找所引用的输出所在的区块，而不是从当前最新的区块开始
+		prevBlock, err := bc.findTransactionBlockFrom(input.TXHash, prevBlockHash)
+		if err != nil {
+			return err
+		}
+		lockValue := input.Sequence & sequenceLockTimeMask
+		if input.Sequence&sequenceLockTimeTypeFlag != 0 {
+			lockSeconds := lockValue << sequenceLockTimeGranularity
+			//与BIP68相同，从所引用的输出所在区块的前一个区块的中位时间开始计算，创世区块没有前一个区块，使用创世区块自身
+			prevTime := bc.medianTimePast(prevBlock.Hash)
+			if prevBlock.Height > 0 {
+				prevTime = bc.medianTimePast(prevBlock.PrevBlockHash)
+			}
+			if medianTime-prevTime < lockSeconds {
+				return fmt.Errorf("交易%x的输入需要在%d秒后才能花费", tx.TxHash, lockSeconds-(medianTime-prevTime))
+			}
+		} else if height-prevBlock.Height < lockValue {
+			return fmt.Errorf("交易%x的输入需要在区块高度%d后才能花费", tx.TxHash, prevBlock.Height+lockValue)
+		}
+	}
+	return nil
+}
+
+//校验区块中所有交易的锁定时间
+func (bc *blockChain) checkBlockLocks(b *Block) error {
+	for _, tx := range b.Txs {
+		if err := bc.checkTransactionLocks(tx, b.Height, b.PrevBlockHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
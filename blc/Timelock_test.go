@@ -0,0 +1,54 @@
+package blc
+
+import (
+	"testing"
+)
+
+//锁定到以后的区块高度的交易不能被打包，到达锁定高度后可以打包
+func TestAbsoluteLockTimeRejected(t *testing.T) {
+	alice := newTestWallet(t, 1, KeyTypeSecp256k1)
+	bob := newTestWallet(t, 2, KeyTypeSecp256k1)
+	bc := newTestChain(t, alice)
+	tx := newTestTransaction(t, bc, alice, map[string]float64{string(bob.GetAddress()): 1}, TxOptions{LockTime: 3})
+	if err := bc.AddBlock(string(alice.GetAddress()), []*transaction{tx}); err == nil {
+		t.Fatal("锁定到区块高度3的交易被打包到了区块高度2")
+	}
+	if height := bc.GetBestHeight(); height != 1 {
+		t.Fatalf("交易被拒绝后区块高度为%d，应为1", height)
+	}
+	mineTestBlocks(t, bc, alice, 2)
+	if err := bc.AddBlock(string(alice.GetAddress()), []*transaction{tx}); err != nil {
+		t.Fatalf("到达锁定高度后交易仍被拒绝：%v", err)
+	}
+	if balance := bc.GetBalance(string(bob.GetAddress())); balance != 1 {
+		t.Fatalf("收款方余额为%f，应为1", balance)
+	}
+}
+
+//相对锁定时间从所引用的输出被打包的区块开始计算
+func TestRelativeLockTimeRejected(t *testing.T) {
+	alice := newTestWallet(t, 1, KeyTypeSecp256k1)
+	bob := newTestWallet(t, 2, KeyTypeSecp256k1)
+	bc := newTestChain(t, alice)
+	//第一个区块中的输出需要3个区块的确认
+	tx := newTestTransaction(t, bc, alice, map[string]float64{string(bob.GetAddress()): 1}, TxOptions{Sequence: SequenceFromBlocks(3)})
+	if err := bc.AddBlock(string(alice.GetAddress()), []*transaction{tx}); err == nil {
+		t.Fatal("相对锁定3个区块的输入在区块高度2被花费")
+	}
+	mineTestBlocks(t, bc, alice, 2)
+	if err := bc.AddBlock(string(alice.GetAddress()), []*transaction{tx}); err != nil {
+		t.Fatalf("满足相对锁定时间后交易仍被拒绝：%v", err)
+	}
+}
+
+//以时间表示的相对锁定时间，所有区块在同一时间生成时不能满足
+func TestRelativeLockSecondsRejected(t *testing.T) {
+	alice := newTestWallet(t, 1, KeyTypeSecp256k1)
+	bob := newTestWallet(t, 2, KeyTypeSecp256k1)
+	bc := newTestChain(t, alice)
+	mineTestBlocks(t, bc, alice, 2)
+	tx := newTestTransaction(t, bc, alice, map[string]float64{string(bob.GetAddress()): 1}, TxOptions{Sequence: SequenceFromSeconds(3600)})
+	if err := bc.AddBlock(string(alice.GetAddress()), []*transaction{tx}); err == nil {
+		t.Fatal("相对锁定1小时的输入被立即花费")
+	}
+}
@@ -2,15 +2,12 @@ package blc
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
+	"io/ioutil"
 	"log"
-	"math/big"
-	"os"
+	"math"
 )
 
 //交易结构
@@ -21,6 +18,8 @@ type transaction struct {
 	TxInputs []*TxInput
 	//输出
 	TxOutputs []*TxOutput
+	//锁定时间，为0时不锁定；小于lockTimeThreshold时表示区块高度，否则表示Unix时间戳
+	LockTime int64
 }
 
 //判断是否为创世交易
@@ -46,41 +45,43 @@ func (tx *transaction) hashTransaction() []byte {
 }
 
 //对交易进行数字签名
-func (tx *transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]transaction) {
+func (tx *transaction) Sign(wallet *Wallet, prevTXs map[string]transaction) {
 	if tx.isCoinbase() {
 		return
 	}
 
-	txCopy := tx.TrimmedCopy()
-
-	for inID, vin := range txCopy.TxInputs {
+	for inID, vin := range tx.TxInputs {
 		prevTx := prevTXs[hex.EncodeToString(vin.TXHash)]
-		txCopy.TxInputs[inID].Signature = nil
-		txCopy.TxInputs[inID].PubKey = prevTx.TxOutputs[vin.Vout].Ripemd160Hash
-		txCopy.TxHash = txCopy.Hash()
-		txCopy.TxInputs[inID].PubKey = nil
-
-		r, s, _ := ecdsa.Sign(rand.Reader, &privKey, txCopy.TxHash)
-		signature := append(r.Bytes(), s.Bytes()...)
-
-		tx.TxInputs[inID].Signature = signature
+		prevOutput := prevTx.TxOutputs[vin.Vout]
+		hash := tx.signatureHash(inID, prevOutput.lockingBytes(), prevOutput.Value)
+		tx.TxInputs[inID].Signature = wallet.sign(hash)
 	}
 }
 
+//生成第inID个输入的签名哈希，lockingBytes为该输入所引用的输出的锁定数据，amount为该输出的金额
+//签名包含所花费的金额，离线签名时即使被提供了错误的金额，生成的签名也不能花费真实的输出
+func (tx *transaction) signatureHash(inID int, lockingBytes []byte, amount float64) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.TxInputs[inID].PubKey = lockingBytes
+	data := append(txCopy.Hash(), IntToBytes(int64(math.Float64bits(amount)))...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
 //拷贝一份新的transaction用于数字签名
 func (tx *transaction) TrimmedCopy() transaction {
 	var inputs []*TxInput
 	var outputs []*TxOutput
 
 	for _, input := range tx.TxInputs {
-		inputs = append(inputs, &TxInput{input.TXHash, input.Vout, nil, nil})
+		inputs = append(inputs, &TxInput{TXHash: input.TXHash, Vout: input.Vout, Sequence: input.Sequence})
 	}
 
 	for _, output := range tx.TxOutputs {
-		outputs = append(outputs, &TxOutput{output.Value, output.Ripemd160Hash})
+		outputs = append(outputs, &TxOutput{Value: output.Value, Ripemd160Hash: output.Ripemd160Hash, ScriptPubKey: output.ScriptPubKey, KeyType: output.KeyType})
 	}
 
-	txCopy := transaction{tx.TxHash, inputs, outputs}
+	txCopy := transaction{tx.TxHash, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
@@ -102,31 +103,25 @@ func (tx *transaction) Serialize() []byte {
 	return encoded.Bytes()
 }
 
-//验证数字签名
-func (tx *transaction) Verify(prevTXs map[string]transaction) bool {
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+//用每个输入所引用的输出验证数字签名
+func (tx *transaction) verifyWithOutputs(prevOutputs []*TxOutput) bool {
 	for i, input := range tx.TxInputs {
-		prevTx := prevTXs[hex.EncodeToString(input.TXHash)]
-		txCopy.TxInputs[i].Signature = nil
-		txCopy.TxInputs[i].PubKey = prevTx.TxOutputs[input.Vout].Ripemd160Hash
-		txCopy.TxHash = txCopy.Hash()
-		txCopy.TxInputs[i].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(input.Signature)
-		r.SetBytes(input.Signature[:(sigLen / 2)])
-		s.SetBytes(input.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(input.PubKey)
-		x.SetBytes(input.PubKey[:(keyLen / 2)])
-		y.SetBytes(input.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.TxHash, &r, &s) == false {
+		prevOutput := prevOutputs[i]
+		//带有锁定脚本的输出，需要执行解锁脚本和锁定脚本进行验证
+		if len(prevOutput.ScriptPubKey) > 0 {
+			if err := verifyScript(tx, i, input.ScriptSig, prevOutput.ScriptPubKey, prevOutput.Value); err != nil {
+				log.Println(err)
+				return false
+			}
+			continue
+		}
+		//公钥必须与输出中的公钥哈希和密钥类型一致
+		scheme, _, ok := schemeForPubKey(input.PubKey)
+		if !ok || scheme.keyType() != prevOutput.KeyType || !bytes.Equal(HashPubKey(input.PubKey), prevOutput.Ripemd160Hash) {
+			return false
+		}
+		hash := tx.signatureHash(i, prevOutput.Ripemd160Hash, prevOutput.Value)
+		if !verifySignature(input.PubKey, hash, input.Signature) {
 			return false
 		}
 	}
@@ -143,50 +138,83 @@ func (tx *transaction) Verify(prevTXs map[string]transaction) bool {
 //普通交易中需要 input ，而 input 是来自父交易的 output ，所以普通交易是有父交易的，
 //但是 Coinbase 交易是没有父交易的，因为币是直接由系统生成的。
 func NewCoinbaseTransaction(address string) *transaction {
-	//设置交易的输入输出
-	txInput := &TxInput{[]byte{}, -1, nil, []byte{}}
-	txOutput := NewTXOutput(10, address)
-	txCoinbase := &transaction{[]byte{}, []*TxInput{txInput}, []*TxOutput{txOutput}}
+	return newCoinbaseTransactionWithFees(address, 0, 0)
+}
+
+//创建高度为height的区块的挖矿奖励交易，奖励由当前网络的参数决定，矿工同时获得区块中所有交易的手续费
+func newCoinbaseTransactionWithFees(address string, height int64, fees float64) *transaction {
+	//设置交易的输入输出，输入的解锁脚本中记录区块高度（参照比特币的BIP34），
+	//使不同区块中奖励给同一地址、金额相同的挖矿奖励交易具有不同的哈希值，不会在UTXO池中互相覆盖
+	txInput := &TxInput{TXHash: []byte{}, Vout: -1, PubKey: []byte{}, ScriptSig: IntToBytes(height)}
+	txOutput := NewTXOutput(activeNetParams.subsidy(height)+fees, address)
+	txCoinbase := &transaction{[]byte{}, []*TxInput{txInput}, []*TxOutput{txOutput}, 0}
 	//设置交易的哈希值
 	txCoinbase.TxHash = txCoinbase.hashTransaction()
 	return txCoinbase
 }
 
+//创建交易时的可选参数
+type TxOptions struct {
+	//交易的锁定时间，小于lockTimeThreshold时表示区块高度，否则表示Unix时间戳
+	LockTime int64
+	//每个输入的相对锁定时间，编码方式见Timelock.go
+	Sequence int64
+	//附加到交易中的数据，会生成一个不可花费的数据输出
+	Data []byte
+	//选币策略，见CoinSelection.go，为空时使用分支定界策略
+	Strategy string
+	//每字节的手续费，为0时不支付手续费
+	FeeRate float64
+	//指定使用的UTXO，不为nil时不进行选币
+	Inputs []OutPoint
+}
+
 //创建一个新的交易，可以有多个输入（就是同一个人可以引用的以前的多个输出）和多个输出，
 //但是同一个交易只能向同一个人输出一次
 //from：出钱的人，只能有一个
 //tos：收钱的人，可以有多个
-func NewTransaction(from string, tos map[string]float64, bc *blockChain) *transaction {
-	nodeId := os.Getenv("NODE_ID")
-	if nodeId == "" {
-		log.Fatal("无法获取NODE_ID的环境变量")
-	}
-	wallets, err := getAllWallets(nodeId)
+func NewTransaction(from string, tos map[string]float64, opts TxOptions, bc *blockChain) *transaction {
+	wallets, err := getAllWallets(getNodeId())
 	if err != nil {
 		log.Panic(err)
 	}
-	wallet := wallets[from]
+	wallet, ok := wallets[canonicalAddress(from)]
+	if !ok {
+		log.Fatal("当前节点的钱包中不存在地址" + from)
+	}
+	if wallet.isLocked() {
+		log.Fatal(errWalletLocked)
+	}
+	tx := newUnsignedTransaction(from, wallet.addressPubKey(), tos, opts, bc)
+	//进行数字签名。签名的作用在于当A转账给B的时候，A只能花费属于他自己的钱来转给B
+	bc.SignTransaction(tx, wallet)
+	return tx
+}
+
+//创建一个未签名的交易，pubKey为写入每个输入中的公钥，多重签名等脚本输出的输入中不需要公钥
+func newUnsignedTransaction(from string, pubKey []byte, tos map[string]float64, opts TxOptions, bc *blockChain) *transaction {
 	var totalAmount float64 = 0
 	for _, amount := range tos {
 		totalAmount += amount
 	}
-	suitableUTXOs, total := bc.findSuitableUTXOs(from, totalAmount)
-	if total < totalAmount {
-		log.Fatal("余额不足，无法创建当前交易！")
+	outputCount := len(tos)
+	if opts.Data != nil {
+		outputCount++
+	}
+	selection, err := bc.findSuitableUTXOs(from, totalAmount, outputCount, opts)
+	if err != nil {
+		log.Fatal(err)
 	}
 	var inputs []*TxInput
 	var outputs []*TxOutput
 	//创建输入
-	for txHashStr, index := range suitableUTXOs {
-		txHash, err := hex.DecodeString(txHashStr)
-		if err != nil {
-			log.Panic(err)
-		}
+	for _, utxo := range selection.UTXOs {
 		input := &TxInput{
-			TXHash:    []byte(txHash),
-			Vout:      index,
+			TXHash:    utxo.TxHash,
+			Vout:      utxo.Vout,
 			Signature: nil,
-			PubKey:    wallet.PublicKey,
+			PubKey:    pubKey,
+			Sequence:  opts.Sequence,
 		}
 		inputs = append(inputs, input)
 	}
@@ -196,18 +224,44 @@ func NewTransaction(from string, tos map[string]float64, bc *blockChain) *transa
 		output := NewTXOutput(amount, to)
 		outputs = append(outputs, output)
 	}
-	//找零给自己
-	if total > totalAmount {
-		output := NewTXOutput(total-totalAmount, from)
+	//找零给自己，输入总额减去输出总额和找零即为手续费
+	if selection.Change > 0 {
+		output := NewTXOutput(selection.Change, from)
 		outputs = append(outputs, output)
 	}
-	tx := &transaction{[]byte{}, inputs, outputs}
+	//附加数据
+	if opts.Data != nil {
+		output, err := NewDataOutput(opts.Data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		outputs = append(outputs, output)
+	}
+	tx := &transaction{[]byte{}, inputs, outputs, opts.LockTime}
 	tx.TxHash = tx.hashTransaction()
-	//进行数字签名。签名的作用在于当A转账给B的时候，A只能花费属于他自己的钱来转给B
-	bc.SignTransaction(tx, wallet.PrivateKey)
 	return tx
 }
 
+//将交易保存到文件
+func (tx *transaction) SaveToFile(fileName string) error {
+	return ioutil.WriteFile(fileName, tx.Serialize(), 0644)
+}
+
+//从文件中读取交易
+func LoadTransaction(fileName string) (*transaction, error) {
+	fileContent, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var tx transaction
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	err = decoder.Decode(&tx)
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
 //输入结构
 type TxInput struct {
 	//所引用TXOutput的交易哈希值
@@ -218,6 +272,10 @@ type TxInput struct {
 	Signature []byte
 	//原生的公钥
 	PubKey []byte
+	//解锁脚本，花费带有锁定脚本的输出时使用
+	ScriptSig []byte
+	//相对锁定时间，为0时不锁定
+	Sequence int64
 }
 
 func (input *TxInput) UnlockRipemd160Hash(Ripemd160Hash []byte) bool {
@@ -231,24 +289,77 @@ type TxOutput struct {
 	Value float64
 	//经过一次256哈希，再经过一次160哈希之后的收款方的公钥，用于锁定当前输出中的钱只属于收款方的
 	Ripemd160Hash []byte
+	//锁定脚本，为空时表示当前输出只由Ripemd160Hash锁定
+	ScriptPubKey []byte
+	//只由Ripemd160Hash锁定时，花费该输出的公钥的密钥类型
+	KeyType byte
 }
 
-//设置Ripemd160Hash
+//根据地址的版本号设置Ripemd160Hash或锁定脚本
 func (output *TxOutput) Lock(address string) {
-	publicKeyHash := Base58Decode([]byte(address))
-	output.Ripemd160Hash = publicKeyHash[1 : len(publicKeyHash)-4]
+	addr, err := ParseAddress(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	switch addr.Version {
+	case activeNetParams.MultisigAddrID:
+		output.ScriptPubKey = addr.Payload
+	case activeNetParams.ScriptHashAddrID:
+		output.ScriptPubKey = buildScriptHashScript(addr.Payload)
+	default:
+		output.Ripemd160Hash = addr.Payload
+		if scheme, ok := schemeByAddressVersion(addr.Version); ok {
+			output.KeyType = scheme.keyType()
+		}
+	}
 }
 
 //判断当前output的锁定脚本能否被当前地址的解锁脚本解锁
 func (output *TxOutput) UnLockScriptPubKeyWithAddress(address string) bool {
-	publicKeyHash := Base58Decode([]byte(address))
-	hash160 := publicKeyHash[1 : len(publicKeyHash)-4]
-	return bytes.Compare(hash160, output.Ripemd160Hash) == 0
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return false
+	}
+	switch addr.Version {
+	case activeNetParams.MultisigAddrID:
+		return bytes.Compare(addr.Payload, output.ScriptPubKey) == 0
+	case activeNetParams.ScriptHashAddrID:
+		return bytes.Compare(buildScriptHashScript(addr.Payload), output.ScriptPubKey) == 0
+	default:
+		scheme, ok := schemeByAddressVersion(addr.Version)
+		return ok && len(output.ScriptPubKey) == 0 && output.KeyType == scheme.keyType() && bytes.Compare(addr.Payload, output.Ripemd160Hash) == 0
+	}
+}
+
+//返回当前输出的收款地址，数据输出没有地址，返回空字符串
+func (output *TxOutput) address() string {
+	if output.isUnspendable() {
+		return ""
+	}
+	if hash, ok := extractScriptHash(output.ScriptPubKey); ok {
+		return string(encodeAddress(activeNetParams.ScriptHashAddrID, hash))
+	}
+	if len(output.ScriptPubKey) > 0 {
+		return string(encodeAddress(activeNetParams.MultisigAddrID, output.ScriptPubKey))
+	}
+	scheme, ok := signatureSchemes[output.KeyType]
+	if !ok {
+		return ""
+	}
+	return string(encodeAddress(scheme.addressVersion(), output.Ripemd160Hash))
+}
+
+//返回签名时代表当前输出锁定条件的数据
+func (output *TxOutput) lockingBytes() []byte {
+	if len(output.ScriptPubKey) > 0 {
+		return output.ScriptPubKey
+	}
+	return output.Ripemd160Hash
 }
 
 //创建输入
 func NewTXOutput(value float64, address string) *TxOutput {
-	txOutput := &TxOutput{value, nil}
+	txOutput := &TxOutput{Value: value}
 	//设置Ripemd160Hash
 	txOutput.Lock(address)
 	return txOutput
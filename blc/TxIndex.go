@@ -0,0 +1,68 @@
+package blc
+
+import (
+	"log"
+)
+
+//交易索引：记录最长链上每个交易所在的区块和在区块中的位置，FindTransaction不需要从最新区块开始遍历区块链
+//交易索引是可选的，在配置文件中设置txindex = true时启用，启用前已有的区块需要用reindex命令建立索引
+//key为交易哈希，value为区块哈希加上8字节大端序的交易位置
+
+//交易索引所在的数据库表
+const txIndexTableName = "txindex"
+
+//将区块中的交易加入交易索引
+func (tx *StoreTx) connectTxIndex(b *Block) error {
+	for i, blockTx := range b.Txs {
+		location := append(append([]byte{}, b.Hash...), IntToBytes(int64(i))...)
+		err := tx.backend.put(txIndexTableName, blockTx.TxHash, location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//从交易索引中删除区块中的交易
+func (tx *StoreTx) disconnectTxIndex(b *Block) error {
+	for _, blockTx := range b.Txs {
+		err := tx.backend.delete(txIndexTableName, blockTx.TxHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//在交易索引中查找交易所在的区块和在区块中的位置，索引中没有该交易时返回nil
+func (tx *StoreTx) txBlock(txHash []byte) (*Block, int) {
+	location := tx.backend.get(txIndexTableName, txHash)
+	if len(location) <= 8 {
+		return nil, 0
+	}
+	b := tx.Block(location[:len(location)-8])
+	position := int(BytesToInt(location[len(location)-8:]))
+	if b == nil || position >= len(b.Txs) {
+		return nil, 0
+	}
+	return b, position
+}
+
+//在交易索引中查找交易所在的区块，交易索引未启用或未建立时ok为false，
+//ok为true时索引包含最长链上的所有交易，b为nil表示交易不存在
+func (bc *blockChain) findIndexedTransactionBlock(txHash []byte) (b *Block, ok bool) {
+	if !cfg.TxIndex {
+		return nil, false
+	}
+	err := bc.Store.View(func(tx *StoreTx) error {
+		ok = tx.indexReady(txIndexTableName)
+		if ok {
+			b, _ = tx.txBlock(txHash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	return b, ok
+}
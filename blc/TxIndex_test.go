@@ -0,0 +1,90 @@
+package blc
+
+import (
+	"bytes"
+	"testing"
+)
+
+//启用并建立交易索引后，FindTransaction只在索引中查找，索引中没有的交易直接返回不存在
+func TestFindTransactionWithIndex(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	to := string(newTestWallet(t, 2, KeyTypeP256).GetAddress())
+	bc := newTestChain(t, miner)
+	cfg.TxIndex = true
+	if err := bc.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	tx := newTestTransaction(t, bc, miner, map[string]float64{to: 1}, TxOptions{})
+	if err := bc.AddBlock(string(miner.GetAddress()), []*transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlocks(t, bc, miner, 2)
+	found, err := bc.FindTransaction(tx.TxHash)
+	if err != nil || !bytes.Equal(found.TxHash, tx.TxHash) {
+		t.Fatalf("没有在索引中找到交易：%v", err)
+	}
+	if _, err := bc.FindTransaction([]byte("missing")); err == nil {
+		t.Fatal("找到了不存在的交易")
+	}
+
+	//从索引中删除交易后不再遍历区块链
+	err = bc.Store.Update(func(storeTx *StoreTx) error {
+		return storeTx.Delete(txIndexTableName, tx.TxHash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.FindTransaction(tx.TxHash); err == nil {
+		t.Fatal("索引中没有的交易通过遍历区块链找到")
+	}
+	//未启用交易索引时遍历区块链
+	cfg.TxIndex = false
+	if _, err := bc.FindTransaction(tx.TxHash); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//创建有n个区块的区块链，返回第一个区块中的交易哈希，查找它时需要遍历几乎整个区块链
+func newBenchmarkChain(b *testing.B, n int, txIndex bool) (*blockChain, []byte) {
+	b.Helper()
+	miner := newTestWallet(b, 1, KeyTypeP256)
+	bc := newTestChain(b, miner)
+	cfg.TxIndex = txIndex
+	if err := bc.Reindex(); err != nil {
+		b.Fatal(err)
+	}
+	first := bc.Iterator().Next()
+	mineTestBlocks(b, bc, miner, n-2)
+	return bc, first.Txs[0].TxHash
+}
+
+func BenchmarkFindTransaction(b *testing.B) {
+	for _, bench := range []struct {
+		name    string
+		txIndex bool
+	}{
+		{"walk", false},
+		{"txindex", true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			bc, txHash := newBenchmarkChain(b, 3000, bench.txIndex)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := bc.FindTransaction(txHash); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+//交易索引启用时，查找不存在的交易不需要遍历区块链
+func BenchmarkFindMissingTransaction(b *testing.B) {
+	bc, _ := newBenchmarkChain(b, 3000, true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bc.FindTransaction([]byte("missing")); err == nil {
+			b.Fatal("找到了不存在的交易")
+		}
+	}
+}
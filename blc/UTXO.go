@@ -1,11 +1,10 @@
 package blc
 
 import (
-	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"github.com/boltdb/bolt"
+	"fmt"
 	"log"
+	"sort"
 )
 
 //UTXO池所在的数据库表
@@ -22,89 +21,133 @@ type UTXOSet struct {
 	bc *blockChain
 }
 
-//重置UTXO池
+//UTXO池的回滚数据所在的数据库表，key为区块哈希，value为区块中的交易所花费的输出，区块断开时用于恢复这些输出
+const utxoUndoTableName = "utxoUndo"
+
+//被区块中的交易花费的输出
+type spentOutput struct {
+	TxHash []byte
+	UTXO   UTXO
+}
+
+//重置UTXO池：清空UTXO池和回滚数据，再从创世区块开始重新连接最长链上的所有区块
 func (utxoSet *UTXOSet) ResetUTXOSet() {
-	err := utxoSet.bc.Db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(utxoTableName))
-		if bucket != nil {
-			tx.DeleteBucket([]byte(utxoTableName))
+	err := utxoSet.bc.Store.Update(func(tx *StoreTx) error {
+		return tx.rebuildUTXOs()
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+//在事务中重建UTXO池
+func (tx *StoreTx) rebuildUTXOs() error {
+	err := tx.ClearUTXOs()
+	if err != nil {
+		return err
+	}
+	err = tx.backend.deleteTable(utxoUndoTableName)
+	if err != nil {
+		return err
+	}
+	for height := int64(0); ; height++ {
+		b := tx.Block(tx.BlockHashByHeight(height))
+		if b == nil {
+			return nil
 		}
-		bucket, err := tx.CreateBucket([]byte(utxoTableName))
+		_, err = tx.connectUTXOs(b)
 		if err != nil {
 			return err
 		}
-		outputsMap := utxoSet.bc.FindUTXOs()
-		for txHashStr, outputs := range outputsMap {
-			txHash, err := hex.DecodeString(txHashStr)
-			if err != nil {
-				return err
-			}
-			utxos, err := json.Marshal(outputs)
-			if err != nil {
-				return err
+	}
+}
+
+//区块连接到最长链时更新UTXO池：删除交易所花费的输出，加入交易的输出，并保存回滚数据
+//返回每个交易的输入所花费的输出，coinbase交易为nil，同一个区块中后面的交易可以花费前面的交易的输出
+func (tx *StoreTx) connectUTXOs(b *Block) ([][]*TxOutput, error) {
+	var spent []spentOutput
+	prevOutputs := make([][]*TxOutput, len(b.Txs))
+	for i, blockTx := range b.Txs {
+		if !blockTx.isCoinbase() {
+			for _, input := range blockTx.TxInputs {
+				utxos := tx.UTXOs(input.TXHash)
+				found := -1
+				for j, utxo := range utxos {
+					if utxo.Vout == input.Vout {
+						found = j
+						break
+					}
+				}
+				if found < 0 {
+					return nil, fmt.Errorf("交易%x所花费的输出%x:%d不存在或已被花费", blockTx.TxHash, input.TXHash, input.Vout)
+				}
+				spent = append(spent, spentOutput{input.TXHash, utxos[found]})
+				prevOutputs[i] = append(prevOutputs[i], utxos[found].Output)
+				err := tx.putTxUTXOs(input.TXHash, append(utxos[:found], utxos[found+1:]...))
+				if err != nil {
+					return nil, err
+				}
 			}
-			err = bucket.Put(txHash, utxos)
-			if err != nil {
-				return err
+		}
+		var utxos []UTXO
+		for vout, output := range blockTx.TxOutputs {
+			//数据输出不可花费，不需要加入UTXO池
+			if output.isUnspendable() {
+				continue
 			}
+			utxos = append(utxos, UTXO{output, int64(vout)})
 		}
-		return nil
-	})
+		err := tx.putTxUTXOs(blockTx.TxHash, utxos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	spentBytes, err := json.Marshal(spent)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
+	return prevOutputs, tx.backend.put(utxoUndoTableName, b.Hash, spentBytes)
 }
 
-//更新UTXO池
-func (utxoSet *UTXOSet) UpdateUTXOSet(txs []*transaction) bool {
-	if txs != nil {
-		err := utxoSet.bc.Db.Update(func(boltTx *bolt.Tx) error {
-			bucket := boltTx.Bucket([]byte(utxoTableName))
-			if bucket != nil {
-				for _, tx := range txs {
-					inputs := tx.TxInputs
-					for _, input := range inputs {
-						utxosBytes := bucket.Get(input.TXHash)
-						var utxos []UTXO
-						json.Unmarshal(utxosBytes, &utxos)
-						for i, utxo := range utxos {
-							if input.Vout == utxo.Vout {
-								utxos = append(utxos[:i], utxos[i+1:]...)
-								utxosBytes, err := json.Marshal(utxos)
-								if err != nil {
-									return err
-								}
-								err = bucket.Put(input.TXHash, utxosBytes)
-								if err != nil {
-									return err
-								}
-								break
-							}
-						}
-					}
-					txHash := tx.TxHash
-					outputs := tx.TxOutputs
-					var utxos []UTXO
-					for i, output := range outputs {
-						utxo := UTXO{output, int64(i)}
-						utxos = append(utxos, utxo)
-					}
-					utxosBytes, err := json.Marshal(utxos)
-					if err != nil {
-						return err
-					}
-					err = bucket.Put(txHash, utxosBytes)
-					if err != nil {
-						return err
-					}
-				}
-				return nil
-			}
-			return errors.New("UTXOSet数据不存在")
-		})
+//区块从最长链上断开时恢复UTXO池：按与连接时相反的顺序删除交易的输出，恢复交易所花费的输出
+func (tx *StoreTx) disconnectUTXOs(b *Block) error {
+	spentBytes := tx.backend.get(utxoUndoTableName, b.Hash)
+	if spentBytes == nil {
+		return fmt.Errorf("区块%x没有UTXO池的回滚数据，请运行reindex命令", b.Hash)
+	}
+	var spent []spentOutput
+	err := json.Unmarshal(spentBytes, &spent)
+	if err != nil {
+		return err
+	}
+	for i := len(b.Txs) - 1; i >= 0; i-- {
+		blockTx := b.Txs[i]
+		err := tx.backend.delete(utxoTableName, blockTx.TxHash)
 		if err != nil {
-			log.Panic(err)
+			return err
+		}
+		if blockTx.isCoinbase() {
+			continue
+		}
+		//回滚数据按输入的顺序保存，当前交易的输入在末尾
+		restored := spent[len(spent)-len(blockTx.TxInputs):]
+		spent = spent[:len(spent)-len(blockTx.TxInputs)]
+		for _, s := range restored {
+			utxos := append(tx.UTXOs(s.TxHash), s.UTXO)
+			sort.Slice(utxos, func(i, j int) bool { return utxos[i].Vout < utxos[j].Vout })
+			err := tx.PutUTXOs(s.TxHash, utxos)
+			if err != nil {
+				return err
+			}
 		}
 	}
-	return true
+	return tx.backend.delete(utxoUndoTableName, b.Hash)
+}
+
+//保存交易的未花费输出，全部花费后删除该交易
+func (tx *StoreTx) putTxUTXOs(txHash []byte, utxos []UTXO) error {
+	if len(utxos) == 0 {
+		return tx.backend.delete(utxoTableName, txHash)
+	}
+	return tx.PutUTXOs(txHash, utxos)
 }
@@ -5,10 +5,36 @@ import (
 	"encoding/binary"
 	"encoding/gob"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
 )
 
+//先写入临时文件再重命名，避免写入过程中出错导致原文件损坏
+func writeFileAtomic(fileName string, data []byte, perm os.FileMode) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
 //将int64类型直接转换为字节数组
 func IntToBytes(num int64) []byte {
 	buff := bytes.NewBuffer([]byte{})
@@ -4,14 +4,16 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/ripemd160"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"os"
+	"strings"
 )
 
 //第一步：创建钱包，生成私钥和公钥
@@ -21,8 +23,8 @@ import (
 //第五步：将第四步得到的32字节的字节数组中的前面4个字节（也就是地址校验所需的长度）取出来，并添加到第三步得到的21字节的末尾，生成一个25字节的字节数组
 //第六步：将第五步得到的25字节的字节数组进行base58编码，得到钱包地址
 
-//版本号，占两个十六进制位，也就是一个字节
-const version = byte(0X00)
+//导出的私钥中表示P-256压缩公钥的标记，与比特币相同
+const privateKeyCompressed = byte(0x01)
 
 //地址校验时需要用到的 checksum 算法中的字节长度，固定为4个字节
 const addressChecksumLen = 4
@@ -31,25 +33,194 @@ const addressChecksumLen = 4
 const walletsFileName = "wallets_%s.dat"
 
 type Wallet struct {
-	//私钥，类型为椭圆曲线数字签名算法的库中的私钥类型
+	//私钥，类型为椭圆曲线数字签名算法的库中的私钥类型，密钥类型不是P-256时只使用其中的D
 	PrivateKey ecdsa.PrivateKey
-	//由私钥生成的公钥
+	//由私钥生成的公钥，密钥类型不是P-256时带有类型标签
 	PublicKey []byte
+	//HD钱包中的派生路径
+	Path string
+	//密钥类型，决定签名算法和地址的版本号
+	KeyType byte
+	//旧版本钱包中没有补齐为64字节的P-256公钥，地址由它生成，交易输入中也使用它；其他钱包为nil
+	LegacyPublicKey []byte
 }
 
-//创建钱包并保存到本地文件
-func NewWallet(nodeId string) *Wallet {
-	//创建钱包
-	private, public := newKeyPair()
-	wallet := &Wallet{private, public}
+//钱包在文件中的存储格式，ecdsa.PrivateKey中的椭圆曲线无法直接进行gob序列化，因此只存储私钥的字节数组
+type walletData struct {
+	PrivateKey      []byte
+	PublicKey       []byte
+	Path            string
+	KeyType         byte
+	LegacyPublicKey []byte
+}
+
+//钱包文件中存储的数据
+type walletFile struct {
+	//HD钱包的种子，所有地址都由种子派生
+	Seed []byte
+	//生成种子的助记词，旧版本中直接随机生成种子，没有助记词
+	Mnemonic string
+	//下一个地址的派生索引
+	NextIndex uint32
+	//所有钱包，key为钱包地址的字符串
+	Wallets map[string]*Wallet
+	//只读地址，key为地址的字符串
+	WatchOnly map[string]*watchOnlyAddress
+	//地址和交易的标签，key为地址或交易哈希的十六进制字符串
+	Labels map[string]string
+	//加密参数及密文，为nil时钱包文件没有加密
+	Encryption *walletEncryption
+	//解锁后由密码派生的密钥，不保存到文件中
+	key []byte
+}
+
+//创建钱包并保存到本地文件，钱包由HD钱包的种子按照下一个派生索引派生，keyType为钱包的密钥类型
+//第一次创建钱包时生成助记词，并由助记词和密码生成种子，之后创建钱包时忽略密码
+func NewWallet(nodeId, passphrase string, keyType byte) *Wallet {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		log.Panic(err)
+	}
+	if wf.isLocked() {
+		log.Fatal(errWalletLocked)
+	}
+	if wf.Seed == nil {
+		wf.Mnemonic, err = NewMnemonic()
+		if err != nil {
+			log.Panic(err)
+		}
+		wf.Seed, err = MnemonicToSeed(wf.Mnemonic, passphrase)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else if passphrase != "" {
+		log.Println("钱包的种子已经生成，本次设置的密码不会生效")
+	}
+	wallet, err := wf.deriveNextWallet(keyType)
+	if err != nil {
+		log.Panic(err)
+	}
 	//将创建的钱包保存到本地文件
-	err := wallet.saveToFile(nodeId)
+	err = wf.save(nodeId)
 	if err != nil {
 		log.Panic(err)
 	}
 	return wallet
 }
 
+//由种子派生出下一个钱包，并加入钱包集合
+func (wf *walletFile) deriveNextWallet(keyType byte) (*Wallet, error) {
+	masterKey, err := NewMasterKey(wf.Seed)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := hdAddressPath(wf.NextIndex)
+		wf.NextIndex++
+		key, err := masterKey.DerivePath(path)
+		if err != nil {
+			//极小概率出现的无效索引直接跳过
+			log.Println(err)
+			continue
+		}
+		wallet, err := key.toWallet(path, keyType)
+		if err != nil {
+			return nil, err
+		}
+		wf.Wallets[string(wallet.GetAddress())] = wallet
+		return wallet, nil
+	}
+}
+
+//由种子恢复钱包，isUsed用于判断地址是否被使用过
+func RestoreWallet(nodeId string, seed []byte, isUsed func(pubKeyHash []byte) bool) ([]string, error) {
+	return restoreWalletFile(nodeId, &walletFile{Seed: seed, Wallets: make(map[string]*Wallet), WatchOnly: make(map[string]*watchOnlyAddress)}, isUsed)
+}
+
+//由助记词和密码恢复钱包，isUsed用于判断地址是否被使用过
+func RestoreWalletFromMnemonic(nodeId, mnemonic, passphrase string, isUsed func(pubKeyHash []byte) bool) ([]string, error) {
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	return restoreWalletFile(nodeId, &walletFile{Seed: seed, Mnemonic: mnemonic, Wallets: make(map[string]*Wallet), WatchOnly: make(map[string]*watchOnlyAddress)}, isUsed)
+}
+
+//恢复钱包：由种子依次派生地址，直到连续hdGapLimit个地址都没有被使用过，返回恢复的地址
+//同一个索引的私钥可以作为不同类型的密钥，每个索引都检查所有密钥类型的地址，使用压缩公钥的P-256地址总是恢复
+func restoreWalletFile(nodeId string, wf *walletFile, isUsed func(pubKeyHash []byte) bool) ([]string, error) {
+	if _, err := os.Stat(dataFileName(walletsFileName, nodeId)); err == nil {
+		return nil, errors.New("钱包文件已存在，为避免覆盖已有的私钥，请先备份并移除钱包文件")
+	}
+	masterKey, err := NewMasterKey(wf.Seed)
+	if err != nil {
+		return nil, err
+	}
+	var pending []*Wallet
+	var addresses []string
+	unused := 0
+	for index := uint32(0); unused < hdGapLimit; index++ {
+		path := hdAddressPath(index)
+		key, err := masterKey.DerivePath(path)
+		if err != nil {
+			continue
+		}
+		candidates, err := key.walletCandidates(path)
+		if err != nil {
+			return nil, err
+		}
+		used := false
+		for i, wallet := range candidates {
+			if isUsed(HashPubKey(wallet.PublicKey)) {
+				used = true
+				pending = append(pending, wallet)
+			} else if i == 0 {
+				pending = append(pending, wallet)
+			}
+		}
+		if !used {
+			unused++
+			continue
+		}
+		//最后一个使用过的地址之前的所有地址都需要恢复
+		for _, w := range pending {
+			wf.Wallets[string(w.GetAddress())] = w
+			addresses = append(addresses, string(w.GetAddress()))
+		}
+		pending = nil
+		wf.NextIndex = index + 1
+		unused = 0
+	}
+	//没有使用过的地址时，恢复第一个地址
+	if len(wf.Wallets) == 0 {
+		wallet, err := wf.deriveNextWallet(KeyTypeP256)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, string(wallet.GetAddress()))
+	}
+	if err := wf.save(nodeId); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+//返回HD钱包账户的扩展私钥
+func (wf *walletFile) accountKey() (*ExtendedKey, error) {
+	if wf.isLocked() {
+		return nil, errWalletLocked
+	}
+	if wf.Seed == nil {
+		return nil, errors.New("钱包中没有种子，请先创建钱包")
+	}
+	masterKey, err := NewMasterKey(wf.Seed)
+	if err != nil {
+		return nil, err
+	}
+	return masterKey.DerivePath(hdAccountPath())
+}
+
 //获取所有钱包地址
 func GetAllAddress(nodeId string) []string {
 	wallets, err := getAllWallets(nodeId)
@@ -65,57 +236,263 @@ func GetAllAddress(nodeId string) []string {
 
 //从本地文件中获取所有已经创建的钱包
 func getAllWallets(nodeId string) (map[string]*Wallet, error) {
-	walletsFileName := fmt.Sprintf(walletsFileName, nodeId)
-	//定义钱包数据集合，key为钱包地址的字符串，value为钱包
-	var wallets map[string]*Wallet
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return nil, err
+	}
+	return wf.Wallets, nil
+}
+
+//从本地文件中读取钱包数据
+func loadWalletFile(nodeId string) (*walletFile, error) {
+	walletsFileName := dataFileName(walletsFileName, nodeId)
+	wf := &walletFile{}
 	//校验钱包数据所在的文件是否存在
 	if _, err := os.Stat(walletsFileName); os.IsNotExist(err) { //如果钱包数据所在的文件不存在，则初始化钱包数据集合
-		wallets = make(map[string]*Wallet)
-	} else { //如果钱包数据所在的文件已经存在，则读出文件中的数据并赋值给钱包数据集合
-		fileContent, err := ioutil.ReadFile(walletsFileName)
-		if err != nil {
+		wf.Wallets = make(map[string]*Wallet)
+		wf.WatchOnly = make(map[string]*watchOnlyAddress)
+		wf.Labels = make(map[string]string)
+		return wf, nil
+	}
+	//如果钱包数据所在的文件已经存在，则读出文件中的数据
+	fileContent, err := ioutil.ReadFile(walletsFileName)
+	if err != nil {
+		return nil, err
+	}
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	err = decoder.Decode(wf)
+	if err != nil {
+		//兼容旧版本的钱包文件，旧版本中直接存储了钱包集合
+		wallets, legacyErr := decodeLegacyWallets(fileContent)
+		if legacyErr != nil {
 			return nil, err
 		}
-		//注册目的在于：可以序列化任何类型
-		gob.Register(elliptic.P256())
-		decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-		err = decoder.Decode(&wallets)
-		if err != nil {
-			return nil, err
+		wf.Wallets = wallets
+	}
+	if wf.Wallets == nil {
+		wf.Wallets = make(map[string]*Wallet)
+	}
+	if wf.WatchOnly == nil {
+		wf.WatchOnly = make(map[string]*watchOnlyAddress)
+	}
+	if wf.Labels == nil {
+		wf.Labels = make(map[string]string)
+	}
+	//加密的钱包在解锁会话有效期内自动解密
+	if wf.Encryption != nil {
+		if key := loadWalletSession(nodeId); key != nil {
+			wf.unlockWithKey(key)
 		}
 	}
+	return wf, nil
+}
+
+//旧版本钱包文件中的钱包结构
+type legacyWallet struct {
+	PrivateKey ecdsa.PrivateKey
+	PublicKey  []byte
+}
+
+//解码旧版本的钱包文件，旧版本中的钱包不是由种子派生的，公钥补齐为64字节
+func decodeLegacyWallets(fileContent []byte) (map[string]*Wallet, error) {
+	var legacyWallets map[string]*legacyWallet
+	//注册目的在于：可以序列化任何类型
+	gob.Register(elliptic.P256())
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	err := decoder.Decode(&legacyWallets)
+	if err != nil {
+		return nil, err
+	}
+	wallets := make(map[string]*Wallet)
+	for address, legacy := range legacyWallets {
+		wallets[address] = legacyP256Wallet(legacy.PrivateKey, legacy.PublicKey)
+	}
 	return wallets, nil
 }
 
-//将当前钱包存储到本地文件
-func (wallet *Wallet) saveToFile(nodeId string) error {
-	walletsFileName := fmt.Sprintf(walletsFileName, nodeId)
-	wallets, err := getAllWallets(nodeId)
+//将钱包数据存储到本地文件
+func (wf *walletFile) save(nodeId string) error {
+	walletsFileName := dataFileName(walletsFileName, nodeId)
+	stored, err := wf.sealed()
 	if err != nil {
 		return err
 	}
-	wallets[string(wallet.GetAddress())] = wallet
 	var content bytes.Buffer
-	gob.Register(elliptic.P256())
 	encoder := gob.NewEncoder(&content)
-	err = encoder.Encode(&wallets)
+	err = encoder.Encode(stored)
 	if err != nil {
 		return err
 	}
-	//将序列化以后的数据写入到文件中，原来文件的数据会被覆盖
-	err = ioutil.WriteFile(walletsFileName, content.Bytes(), 0644)
+	//将序列化以后的数据写入到文件中，原来文件的数据会被覆盖，文件只允许当前用户读写
+	return writeFileAtomic(walletsFileName, content.Bytes(), 0600)
+}
+
+//序列化钱包
+func (wallet *Wallet) GobEncode() ([]byte, error) {
+	var content bytes.Buffer
+	encoder := gob.NewEncoder(&content)
+	var privateKey []byte
+	//钱包锁定时没有私钥
+	if !wallet.isLocked() {
+		privateKey = wallet.PrivateKey.D.Bytes()
+	}
+	err := encoder.Encode(walletData{privateKey, wallet.PublicKey, wallet.Path, wallet.KeyType, wallet.LegacyPublicKey})
+	if err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+//反序列化钱包
+func (wallet *Wallet) GobDecode(data []byte) error {
+	var wd walletData
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&wd)
 	if err != nil {
 		return err
 	}
+	if len(wd.PrivateKey) > 0 {
+		wallet.PrivateKey = privateKeyFromBytes(wd.PrivateKey)
+	}
+	if _, ok := signatureSchemes[wd.KeyType]; !ok {
+		return fmt.Errorf("不支持的密钥类型%d", wd.KeyType)
+	}
+	wallet.PublicKey = wd.PublicKey
+	wallet.Path = wd.Path
+	wallet.KeyType = wd.KeyType
+	wallet.LegacyPublicKey = wd.LegacyPublicKey
 	return nil
 }
 
+//由私钥的字节数组和密钥类型创建钱包
+func newWalletFromKey(d []byte, keyType byte, path string) (*Wallet, error) {
+	scheme, ok := signatureSchemes[keyType]
+	if !ok {
+		return nil, fmt.Errorf("不支持的密钥类型%d", keyType)
+	}
+	if !scheme.validPrivateKey(d) {
+		return nil, errors.New("私钥无效")
+	}
+	return &Wallet{PrivateKey: privateKeyFromBytes(d), PublicKey: tagPubKey(scheme, scheme.publicKey(d)), Path: path, KeyType: keyType}, nil
+}
+
+//返回使用未压缩公钥的P-256钱包，旧版本的钱包地址都由未压缩公钥生成
+func (wallet *Wallet) uncompressed() *Wallet {
+	w := legacyP256Wallet(wallet.PrivateKey, unpaddedP256PublicKey(publicKeyBytes(&wallet.PrivateKey.PublicKey)))
+	w.Path = wallet.Path
+	return w
+}
+
+//由旧版本的私钥和公钥x.Bytes()||y.Bytes()创建钱包，公钥补齐为64字节，
+//原来的公钥不足64字节时保留在LegacyPublicKey中，使地址保持不变
+func legacyP256Wallet(privateKey ecdsa.PrivateKey, pubKey []byte) *Wallet {
+	wallet := &Wallet{PrivateKey: privateKey, PublicKey: publicKeyBytes(&privateKey.PublicKey), KeyType: KeyTypeP256}
+	if !bytes.Equal(pubKey, wallet.PublicKey) {
+		wallet.LegacyPublicKey = pubKey
+	}
+	return wallet
+}
+
+//返回生成地址的公钥，交易输入和脚本中的公钥哈希必须与地址一致
+func (wallet *Wallet) addressPubKey() []byte {
+	if wallet.LegacyPublicKey != nil {
+		return wallet.LegacyPublicKey
+	}
+	return wallet.PublicKey
+}
+
+//返回钱包的签名算法
+func (wallet *Wallet) scheme() signatureScheme {
+	return signatureSchemes[wallet.KeyType]
+}
+
+//用钱包的私钥对哈希值进行签名
+func (wallet *Wallet) sign(hash []byte) []byte {
+	return wallet.scheme().sign(wallet.PrivateKey.D.FillBytes(make([]byte, sigScalarLen)), hash)
+}
+
+//导出钱包中的私钥：版本号(1) 私钥(32) [密钥类型(1)] 校验码(4)，再进行base58编码
+//使用未压缩公钥的P-256私钥不包含密钥类型，使用压缩公钥的P-256私钥的密钥类型为privateKeyCompressed
+func ExportPrivateKey(nodeId, address string) (string, error) {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return "", err
+	}
+	wallet, ok := wf.Wallets[canonicalAddress(address)]
+	if !ok {
+		return "", errors.New("当前节点的钱包中不存在地址" + address)
+	}
+	if wallet.isLocked() {
+		return "", errWalletLocked
+	}
+	payload := append([]byte{activeNetParams.PrivateKeyID}, wallet.PrivateKey.D.FillBytes(make([]byte, 32))...)
+	if wallet.KeyType != KeyTypeP256 {
+		payload = append(payload, wallet.KeyType)
+	} else if isCompressedP256PublicKey(wallet.PublicKey) {
+		payload = append(payload, privateKeyCompressed)
+	}
+	return string(Base58Encode(append(payload, checksum(payload)...))), nil
+}
+
+//解析导出的私钥
+func ParsePrivateKey(key string) (*Wallet, error) {
+	decoded, err := Base58Decode([]byte(key))
+	if err != nil {
+		return nil, errors.New("私钥" + err.Error())
+	}
+	if len(decoded) < 1+32+addressChecksumLen || len(decoded) > 1+32+1+addressChecksumLen || decoded[0] != activeNetParams.PrivateKeyID {
+		return nil, errors.New("私钥格式错误")
+	}
+	payload := decoded[:len(decoded)-addressChecksumLen]
+	if !bytes.Equal(checksum(payload), decoded[len(payload):]) {
+		return nil, errors.New("私钥的校验码错误")
+	}
+	if len(payload) == 1+32 {
+		wallet, err := newWalletFromKey(payload[1:], KeyTypeP256, "")
+		if err != nil {
+			return nil, err
+		}
+		return wallet.uncompressed(), nil
+	}
+	keyType := payload[33]
+	if keyType == privateKeyCompressed {
+		keyType = KeyTypeP256
+	}
+	return newWalletFromKey(payload[1:33], keyType, "")
+}
+
+//将私钥导入到钱包中，导入的私钥不是由种子派生的，需要单独备份
+func ImportPrivateKey(nodeId, key string) (string, error) {
+	wallet, err := ParsePrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return "", err
+	}
+	if wf.isLocked() {
+		return "", errWalletLocked
+	}
+	address := string(wallet.GetAddress())
+	if _, ok := wf.Wallets[address]; ok {
+		return "", errors.New("钱包中已经存在地址" + address)
+	}
+	wf.Wallets[address] = wallet
+	return address, wf.save(nodeId)
+}
+
 //返回钱包地址
 func (wallet *Wallet) GetAddress() (address []byte) {
 	//第一步：先对公钥进行哈希运算，先进行一次256哈希，再进行一次160哈希，生成一个20字节的字节数组
-	pubKeyHash := HashPubKey(wallet.PublicKey)
+	pubKeyHash := HashPubKey(wallet.addressPubKey())
+	return encodeAddress(wallet.scheme().addressVersion(), pubKeyHash)
+}
+
+//将版本号和数据编码为地址
+func encodeAddress(version byte, payload []byte) []byte {
 	//第二步：再将版本号的1个字节和第一步得到的20字节的字节数组相加，生成一个21字节的字节数组
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+	versionedPayload := append([]byte{version}, payload...)
 	//第三步：再将第二步得到的21字节的字节数组进行两次256哈希，并将生成的32字节的字节数组中的前面4个字节取出来
 	checksum := checksum(versionedPayload)
 	//第四步：再将第二步得到的21字节加上第三步得到的4个字节,生成一个25字节的字节数组
@@ -124,18 +501,11 @@ func (wallet *Wallet) GetAddress() (address []byte) {
 	return Base58Encode(fullPayload)
 }
 
-//创建私钥和公钥
-func newKeyPair() (ecdsa.PrivateKey, []byte) {
-	//用椭圆曲线的库生成曲线
+//由私钥的字节数组生成私钥
+func privateKeyFromBytes(d []byte) ecdsa.PrivateKey {
 	curve := elliptic.P256()
-	//用椭圆曲线数字签名算法的库，结合曲线和随机数生成私钥
-	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
-	if err != nil {
-		log.Panic(err)
-	}
-	//用私钥生成公钥
-	publicKey := append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...)
-	return *privateKey, publicKey
+	x, y := curve.ScalarBaseMult(d)
+	return ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: new(big.Int).SetBytes(d)}
 }
 
 //对公钥进行哈希运算
@@ -157,20 +527,15 @@ func HashPubKey(pubKey []byte) []byte {
 	return RIPEMD160Hasher.Sum(nil)
 }
 
-//校验地址的有效性
-func ValidateAddress(address string) bool {
-	//第一步：将地址由字符串转为字节数组，并进行base58解码得到一个25字节的字节数组
-	pubKeyHash := Base58Decode([]byte(address))
-	//第二步：将第一步得到的25字节的字节数组中的最后四个字节取出来，得到当前地址的checksum算法中返回的四个字节
-	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
-	//第三步：将第一步得到的25字节的字节数组中的第一个字节取出来得到当前地址中的版本号
-	version := pubKeyHash[0]
-	//第四步：将第一步得到的25字节的字节数组中的第一个字节（也就是版本号）和最后四个字节去掉，得到一个20字节的字节数组
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
-	//第五步：将目标版本号加上第四步得到的20字节的字节数组，并进行checksum算法，得到目标checksum算法中返回的四个字节
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
-	//第六步：目标checksum算法中返回的四个字节和当前地址的checksum算法中返回的四个字节相等，则认为当前地址是合法的
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+//返回钱包地址的Bech32格式
+func (wallet *Wallet) GetBech32Address() (string, error) {
+	addr := Address{Version: wallet.scheme().addressVersion(), Payload: HashPubKey(wallet.addressPubKey())}
+	return addr.Bech32()
+}
+
+//返回赎回脚本对应的P2SH地址
+func ScriptHashAddress(redeemScript []byte) string {
+	return string(encodeAddress(activeNetParams.ScriptHashAddrID, HashPubKey(redeemScript)))
 }
 
 //将字节数组进行两次256哈希，并将生成的32字节的字节数组中的前面4个字节取出来并返回
@@ -0,0 +1,312 @@
+package blc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//钱包文件加密：由密码通过scrypt派生出32字节的密钥，再用AES-256-GCM加密种子、助记词和所有私钥
+//地址和公钥仍以明文存储，钱包锁定时也可以查看地址和余额，但不能签名
+//解锁后由密码派生的密钥只保存在当前进程的内存中，到期后清除，任何时候都不会写入磁盘，
+//因此没有单独的解锁和锁定命令：命令行的每个命令都是独立的进程，解锁只在该命令执行期间有效，
+//需要签名的命令都要加上--unlock参数，从标准输入读取密码，密码不会出现在命令行参数和进程列表中
+
+//scrypt的参数
+const walletScryptN = 32768
+const walletScryptR = 8
+const walletScryptP = 1
+const walletKeyLen = 32
+const walletSaltLen = 16
+
+//用--unlock解锁后，密钥在内存中保留的时间，长时间运行的命令（例如startNode）到期后不能再签名
+const walletUnlockTimeout = 5 * time.Minute
+
+var errWalletLocked = errors.New("钱包已锁定，请使用--unlock参数解锁钱包")
+
+//从标准输入读取密码，同一个命令中可能需要读取多个密码，共用一个缓冲区
+var passphraseReader = bufio.NewReader(os.Stdin)
+
+//钱包文件的加密参数及密文
+type walletEncryption struct {
+	Salt       []byte
+	N          int
+	R          int
+	P          int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+//加密存储的钱包数据
+type walletSecrets struct {
+	Seed     []byte
+	Mnemonic string
+	//key为钱包地址，value为私钥的字节数组
+	PrivateKeys map[string][]byte
+}
+
+//解锁会话，key为由密码派生的密钥，到期后由timer清除
+type walletSession struct {
+	key   []byte
+	timer *time.Timer
+}
+
+//当前进程中的解锁会话，key为节点编号
+var walletSessions = struct {
+	sync.Mutex
+	sessions map[string]*walletSession
+}{sessions: make(map[string]*walletSession)}
+
+//判断钱包是否为加密且未解锁的状态
+func (wf *walletFile) isLocked() bool {
+	return wf.Encryption != nil && wf.key == nil
+}
+
+//判断钱包中的私钥是否不可用
+func (wallet *Wallet) isLocked() bool {
+	return wallet.PrivateKey.D == nil
+}
+
+//由密码派生密钥
+func deriveWalletKey(passphrase string, salt []byte, n, r, p int) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, n, r, p, walletKeyLen)
+}
+
+//用密码加密钱包文件，钱包文件已加密时返回错误
+func (wf *walletFile) encrypt(passphrase string) error {
+	if wf.Encryption != nil {
+		return errors.New("钱包已经加密，请使用changePassphrase命令修改密码")
+	}
+	return wf.setPassphrase(passphrase)
+}
+
+//用新的密码重新派生密钥，钱包必须已经解密
+func (wf *walletFile) setPassphrase(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("密码不能为空")
+	}
+	salt := make([]byte, walletSaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+	key, err := deriveWalletKey(passphrase, salt, walletScryptN, walletScryptR, walletScryptP)
+	if err != nil {
+		return err
+	}
+	wf.Encryption = &walletEncryption{Salt: salt, N: walletScryptN, R: walletScryptR, P: walletScryptP}
+	wf.key = key
+	return nil
+}
+
+//用密码解密钱包，密码错误时返回错误
+func (wf *walletFile) unlock(passphrase string) error {
+	if wf.Encryption == nil {
+		return errors.New("钱包没有加密")
+	}
+	e := wf.Encryption
+	key, err := deriveWalletKey(passphrase, e.Salt, e.N, e.R, e.P)
+	if err != nil {
+		return err
+	}
+	return wf.unlockWithKey(key)
+}
+
+//用密钥解密钱包中的种子、助记词和私钥
+func (wf *walletFile) unlockWithKey(key []byte) error {
+	aead, err := newWalletCipher(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, wf.Encryption.Nonce, wf.Encryption.Ciphertext, nil)
+	if err != nil {
+		return errors.New("密码错误")
+	}
+	var secrets walletSecrets
+	decoder := gob.NewDecoder(bytes.NewReader(plaintext))
+	err = decoder.Decode(&secrets)
+	if err != nil {
+		return err
+	}
+	wf.Seed = secrets.Seed
+	wf.Mnemonic = secrets.Mnemonic
+	for address, d := range secrets.PrivateKeys {
+		if wallet, ok := wf.Wallets[address]; ok {
+			wallet.PrivateKey = privateKeyFromBytes(d)
+		}
+	}
+	wf.key = key
+	return nil
+}
+
+//生成保存到文件中的钱包数据，加密的钱包只保存公开数据和密文
+func (wf *walletFile) sealed() (*walletFile, error) {
+	if wf.Encryption == nil {
+		return wf, nil
+	}
+	stored := &walletFile{NextIndex: wf.NextIndex, Wallets: make(map[string]*Wallet), WatchOnly: wf.WatchOnly, Labels: wf.Labels}
+	for address, wallet := range wf.Wallets {
+		stored.Wallets[address] = &Wallet{PublicKey: wallet.PublicKey, Path: wallet.Path, KeyType: wallet.KeyType, LegacyPublicKey: wallet.LegacyPublicKey}
+	}
+	//钱包锁定时只能修改公开数据，密文保持不变
+	if wf.key == nil {
+		stored.Encryption = wf.Encryption
+		return stored, nil
+	}
+	secrets := walletSecrets{wf.Seed, wf.Mnemonic, make(map[string][]byte)}
+	for address, wallet := range wf.Wallets {
+		if !wallet.isLocked() {
+			secrets.PrivateKeys[address] = wallet.PrivateKey.D.Bytes()
+		}
+	}
+	var content bytes.Buffer
+	encoder := gob.NewEncoder(&content)
+	err := encoder.Encode(secrets)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newWalletCipher(wf.key)
+	if err != nil {
+		return nil, err
+	}
+	//每次保存都使用新的随机数
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	e := *wf.Encryption
+	e.Nonce = nonce
+	e.Ciphertext = aead.Seal(nil, nonce, content.Bytes(), nil)
+	stored.Encryption = &e
+	return stored, nil
+}
+
+//创建AES-256-GCM加密器
+func newWalletCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//解锁钱包，在当前进程中timeout时间内签名时不需要再输入密码
+func UnlockWallet(nodeId, passphrase string, timeout time.Duration) error {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return err
+	}
+	wf.key = nil
+	err = wf.unlock(passphrase)
+	if err != nil {
+		return err
+	}
+	LockWallet(nodeId)
+	session := &walletSession{key: append([]byte{}, wf.key...)}
+	walletSessions.Lock()
+	defer walletSessions.Unlock()
+	session.timer = time.AfterFunc(timeout, func() {
+		walletSessions.Lock()
+		defer walletSessions.Unlock()
+		if walletSessions.sessions[nodeId] == session {
+			session.clear()
+			delete(walletSessions.sessions, nodeId)
+		}
+	})
+	walletSessions.sessions[nodeId] = session
+	return nil
+}
+
+//锁定钱包，清除内存中的解锁会话
+func LockWallet(nodeId string) error {
+	walletSessions.Lock()
+	defer walletSessions.Unlock()
+	if session, ok := walletSessions.sessions[nodeId]; ok {
+		session.timer.Stop()
+		session.clear()
+		delete(walletSessions.sessions, nodeId)
+	}
+	return nil
+}
+
+//将会话中的密钥清零
+func (session *walletSession) clear() {
+	for i := range session.key {
+		session.key[i] = 0
+	}
+}
+
+//读取未过期的解锁会话中的密钥，返回密钥的副本
+func loadWalletSession(nodeId string) []byte {
+	walletSessions.Lock()
+	defer walletSessions.Unlock()
+	session, ok := walletSessions.sessions[nodeId]
+	if !ok {
+		return nil
+	}
+	return append([]byte{}, session.key...)
+}
+
+//从标准输入读取一行作为密码，提示信息输出到标准错误，不影响标准输出中的命令结果
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := passphraseReader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", errors.New("没有从标准输入读取到密码")
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", errors.New("密码不能为空")
+	}
+	return passphrase, nil
+}
+
+//加密钱包文件
+func EncryptWallet(nodeId, passphrase string) error {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return err
+	}
+	if len(wf.Wallets) == 0 {
+		return errors.New("钱包为空，请先创建钱包")
+	}
+	err = wf.encrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	return wf.save(nodeId)
+}
+
+//修改钱包密码，修改后原来的解锁会话失效
+func ChangeWalletPassphrase(nodeId, oldPassphrase, newPassphrase string) error {
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return err
+	}
+	wf.key = nil
+	err = wf.unlock(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	err = wf.setPassphrase(newPassphrase)
+	if err != nil {
+		return err
+	}
+	err = wf.save(nodeId)
+	if err != nil {
+		return err
+	}
+	return LockWallet(nodeId)
+}
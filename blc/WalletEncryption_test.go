@@ -0,0 +1,89 @@
+package blc
+
+import (
+	"bufio"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//判断节点钱包中address的私钥是否可用
+func walletUnlocked(t *testing.T, nodeId, address string) bool {
+	t.Helper()
+	wallets, err := getAllWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return !wallets[address].isLocked()
+}
+
+//解锁后的密钥只保存在内存中，到期或锁定后清除
+func TestUnlockWalletKeepsKeyInMemory(t *testing.T) {
+	resetTestConfig(t)
+	cfg.DataDir = t.TempDir()
+	nodeId := "unlock"
+	address := string(NewWallet(nodeId, "", KeyTypeP256).GetAddress())
+	if err := EncryptWallet(nodeId, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if walletUnlocked(t, nodeId, address) {
+		t.Fatal("加密后钱包没有锁定")
+	}
+
+	if err := UnlockWallet(nodeId, "wrong", time.Minute); err == nil {
+		t.Fatal("错误的密码解锁了钱包")
+	}
+	if err := UnlockWallet(nodeId, "secret", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !walletUnlocked(t, nodeId, address) {
+		t.Fatal("解锁后钱包仍然锁定")
+	}
+	//数据目录中只有钱包文件
+	files, err := ioutil.ReadDir(filepath.Dir(dataFileName(walletsFileName, nodeId)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != filepath.Base(dataFileName(walletsFileName, nodeId)) {
+		t.Fatalf("解锁后数据目录中有%d个文件", len(files))
+	}
+	if err := LockWallet(nodeId); err != nil {
+		t.Fatal(err)
+	}
+	if walletUnlocked(t, nodeId, address) {
+		t.Fatal("锁定后钱包仍然解锁")
+	}
+
+	if err := UnlockWallet(nodeId, "secret", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if walletUnlocked(t, nodeId, address) {
+		t.Fatal("解锁到期后钱包仍然解锁")
+	}
+}
+
+//密码从标准输入按行读取，--unlock参数没有值，不会把后面的命令当作密码
+func TestReadPassphrase(t *testing.T) {
+	old := passphraseReader
+	defer func() { passphraseReader = old }()
+	passphraseReader = bufio.NewReader(strings.NewReader("old secret\r\nnew"))
+	for _, want := range []string{"old secret", "new"} {
+		if passphrase, err := readPassphrase(""); err != nil || passphrase != want {
+			t.Fatalf("读取到密码%q，应为%q：%v", passphrase, want, err)
+		}
+	}
+	if _, err := readPassphrase(""); err == nil {
+		t.Fatal("标准输入结束后仍读取到密码")
+	}
+
+	args, flags, err := parseGlobalFlags([]string{"spc", "--unlock", "send", "--from", "A"}, []string{"unlock"}, "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags["unlock"] != "true" || strings.Join(args, " ") != "spc send --from A" {
+		t.Fatalf("解析结果为%v，%v", args, flags)
+	}
+}
@@ -0,0 +1,300 @@
+package blc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//钱包账本：按地址记录钱包中每个地址的收款和付款，包括所在区块的高度、时间、交易对方、金额和手续费
+//地址第一次查询时扫描最长链建立记录，之后在SetTip连接和断开区块时与UTXO池在同一个事务中更新
+
+//钱包账本所在的数据库表，每条交易记录一个键：地址、0、8字节大端序的区块高度、交易哈希，
+//因此同一个地址的记录连续存放并按区块高度排列，连接区块时只写入新的记录
+const walletLedgerTableName = "walletLedgerTxs"
+
+//已经建立账本的地址所在的数据库表，只有这些地址的记录在连接区块时更新
+const walletLedgerAddressTableName = "walletLedgerAddresses"
+
+//区块写入的账本记录所在的数据库表，key为区块哈希，value为该区块写入的所有键，断开区块时删除这些键
+const walletLedgerBlockTableName = "walletLedgerBlocks"
+
+//交易记录的类别
+const (
+	//收款
+	ledgerReceive = "receive"
+	//付款，地址的输出被花费
+	ledgerSend = "send"
+	//挖矿奖励
+	ledgerGenerate = "generate"
+)
+
+//地址的一条交易记录
+type ledgerEntry struct {
+	TxHash    []byte
+	BlockHash []byte
+	Height    int64
+	Timestamp int64
+	Category  string
+	//地址余额的变化，收款为正，付款为负
+	Amount float64
+	//付款时交易的手续费
+	Fee float64
+	//交易对方的地址，收款时为付款方，付款时为收款方
+	Counterparties []string
+}
+
+//钱包账本
+type WalletLedger struct {
+	bc *blockChain
+}
+
+//地址的交易记录的键的前缀
+func ledgerAddressPrefix(address string) []byte {
+	return append([]byte(address), 0)
+}
+
+//交易记录的键
+func ledgerKey(address string, height int64, txHash []byte) []byte {
+	return append(append(ledgerAddressPrefix(address), IntToBytes(height)...), txHash...)
+}
+
+//返回地址的交易记录，从新到旧排列，limit大于0时最多返回limit条，地址还没有记录时先扫描区块链
+func (ledger *WalletLedger) ListTransactions(address string, limit int) ([]*ledgerEntry, error) {
+	address = canonicalAddress(address)
+	err := ledger.scanAddresses([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ledgerEntry
+	err = ledger.bc.Store.View(func(tx *StoreTx) error {
+		return tx.ForEachPrefix(walletLedgerTableName, ledgerAddressPrefix(address), func(k, v []byte) error {
+			var entry ledgerEntry
+			err := json.Unmarshal(v, &entry)
+			entries = append(entries, &entry)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+//为还没有建立账本的地址扫描最长链，建立交易记录，之后这些地址的记录由SetTip更新
+//扫描与写入在同一个事务中进行，扫描期间最新区块不会改变
+func (ledger *WalletLedger) scanAddresses(addresses []string) error {
+	var pending []string
+	err := ledger.bc.Store.View(func(tx *StoreTx) error {
+		pending = tx.untrackedLedgerAddresses(addresses)
+		return nil
+	})
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	return ledger.bc.Store.Update(func(tx *StoreTx) error {
+		pending := tx.untrackedLedgerAddresses(addresses)
+		if len(pending) == 0 {
+			return nil
+		}
+		//从创世区块开始按顺序处理，被花费的输出总是在之前的区块或同一个区块前面的交易中
+		outputs := make(map[string]*TxOutput)
+		for height := int64(0); ; height++ {
+			b := tx.Block(tx.BlockHashByHeight(height))
+			if b == nil {
+				break
+			}
+			prevOutputs := make([][]*TxOutput, len(b.Txs))
+			for i, blockTx := range b.Txs {
+				if !blockTx.isCoinbase() {
+					for _, input := range blockTx.TxInputs {
+						key := string(outPointKey(input.TXHash, input.Vout))
+						output, ok := outputs[key]
+						if !ok {
+							return fmt.Errorf("交易%x所花费的输出%x:%d不存在", blockTx.TxHash, input.TXHash, input.Vout)
+						}
+						prevOutputs[i] = append(prevOutputs[i], output)
+						delete(outputs, key)
+					}
+				}
+				for vout, output := range blockTx.TxOutputs {
+					outputs[string(outPointKey(blockTx.TxHash, int64(vout)))] = output
+				}
+			}
+			err = tx.putLedgerEntries(b, prevOutputs, pending)
+			if err != nil {
+				return err
+			}
+		}
+		for _, address := range pending {
+			err = tx.Put(walletLedgerAddressTableName, []byte(address), []byte{1})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//返回addresses中还没有建立账本的地址
+func (tx *StoreTx) untrackedLedgerAddresses(addresses []string) []string {
+	var pending []string
+	for _, address := range addresses {
+		if tx.Get(walletLedgerAddressTableName, []byte(address)) == nil {
+			pending = append(pending, address)
+		}
+	}
+	return pending
+}
+
+//区块连接到最长链时，为已经建立账本的地址添加区块中的交易记录，prevOutputs为每个交易的输入所花费的输出
+func (tx *StoreTx) connectWalletLedger(b *Block, prevOutputs [][]*TxOutput) error {
+	//只有与区块中的交易有关的地址才需要检查是否已经建立账本
+	related := make(map[string]bool)
+	for i, blockTx := range b.Txs {
+		for _, output := range append(append([]*TxOutput{}, prevOutputs[i]...), blockTx.TxOutputs...) {
+			if address := output.address(); address != "" {
+				related[address] = true
+			}
+		}
+	}
+	var tracked []string
+	for address := range related {
+		if tx.Get(walletLedgerAddressTableName, []byte(address)) != nil {
+			tracked = append(tracked, address)
+		}
+	}
+	if len(tracked) == 0 {
+		return nil
+	}
+	sort.Strings(tracked)
+	return tx.putLedgerEntries(b, prevOutputs, tracked)
+}
+
+//写入区块中的交易对于addresses中每个地址的交易记录，并记录区块写入的键
+func (tx *StoreTx) putLedgerEntries(b *Block, prevOutputs [][]*TxOutput, addresses []string) error {
+	//扫描新地址时，区块可能已经写入了其他地址的记录
+	var keys [][]byte
+	if keysBytes := tx.Get(walletLedgerBlockTableName, b.Hash); keysBytes != nil {
+		err := json.Unmarshal(keysBytes, &keys)
+		if err != nil {
+			return err
+		}
+	}
+	written := len(keys)
+	for i, blockTx := range b.Txs {
+		for _, address := range addresses {
+			entry := newLedgerEntry(address, blockTx, prevOutputs[i], b)
+			if entry == nil {
+				continue
+			}
+			entryBytes, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			key := ledgerKey(address, b.Height, blockTx.TxHash)
+			err = tx.Put(walletLedgerTableName, key, entryBytes)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == written {
+		return nil
+	}
+	keysBytes, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return tx.Put(walletLedgerBlockTableName, b.Hash, keysBytes)
+}
+
+//区块从最长链上断开时，删除该区块写入的交易记录
+func (tx *StoreTx) disconnectWalletLedger(b *Block) error {
+	keysBytes := tx.Get(walletLedgerBlockTableName, b.Hash)
+	if keysBytes == nil {
+		return nil
+	}
+	var keys [][]byte
+	err := json.Unmarshal(keysBytes, &keys)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = tx.Delete(walletLedgerTableName, key)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Delete(walletLedgerBlockTableName, b.Hash)
+}
+
+//生成交易对于地址的交易记录，交易与地址无关时返回nil
+func newLedgerEntry(address string, tx *transaction, prevOutputs []*TxOutput, block *Block) *ledgerEntry {
+	var received, spent, inputTotal, outputTotal float64
+	counterparties := make(map[string]bool)
+	for _, output := range prevOutputs {
+		inputTotal += output.Value
+		if output.UnLockScriptPubKeyWithAddress(address) {
+			spent += output.Value
+		}
+	}
+	for _, output := range tx.TxOutputs {
+		outputTotal += output.Value
+		if output.UnLockScriptPubKeyWithAddress(address) {
+			received += output.Value
+		}
+	}
+	if received == 0 && spent == 0 {
+		return nil
+	}
+	entry := &ledgerEntry{TxHash: tx.TxHash, BlockHash: block.Hash, Height: block.Height, Timestamp: block.Timestamp, Amount: received - spent}
+	switch {
+	case tx.isCoinbase():
+		entry.Category = ledgerGenerate
+	case spent > 0:
+		entry.Category = ledgerSend
+		entry.Fee = inputTotal - outputTotal
+		//付款时交易对方为其他收款地址
+		for _, output := range tx.TxOutputs {
+			if counterparty := output.address(); counterparty != "" && counterparty != address {
+				counterparties[counterparty] = true
+			}
+		}
+	default:
+		entry.Category = ledgerReceive
+		//收款时交易对方为付款地址
+		for _, output := range prevOutputs {
+			if counterparty := output.address(); counterparty != "" && counterparty != address {
+				counterparties[counterparty] = true
+			}
+		}
+	}
+	for counterparty := range counterparties {
+		entry.Counterparties = append(entry.Counterparties, counterparty)
+	}
+	sort.Strings(entry.Counterparties)
+	return entry
+}
+
+//设置地址或交易的标签，key为地址或交易哈希的十六进制字符串，标签为空时删除标签
+func SetLabel(nodeId, key, label string) error {
+	key = canonicalAddress(key)
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return err
+	}
+	if label == "" {
+		delete(wf.Labels, key)
+	} else {
+		wf.Labels[key] = label
+	}
+	return wf.save(nodeId)
+}
@@ -0,0 +1,109 @@
+package blc
+
+import (
+	"bytes"
+	"testing"
+)
+
+//地址的交易记录的哈希值，从新到旧排列
+func ledgerTxHashes(t *testing.T, bc *blockChain, address string) [][]byte {
+	t.Helper()
+	ledger := WalletLedger{bc}
+	entries, err := ledger.ListTransactions(address, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes [][]byte
+	for _, entry := range entries {
+		hashes = append(hashes, entry.TxHash)
+	}
+	return hashes
+}
+
+//钱包账本随SetTip连接和断开区块而更新，不在最长链上的区块不影响账本
+func TestWalletLedgerFollowsTip(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	minerAddr := string(miner.GetAddress())
+	bobAddr := string(newTestWallet(t, 2, KeyTypeSchnorr).GetAddress())
+	bc := newTestChain(t, miner)
+	first := bc.Iterator().Next()
+	//先建立账本，之后的记录由SetTip写入
+	if hashes := ledgerTxHashes(t, bc, bobAddr); len(hashes) != 0 {
+		t.Fatalf("bob有%d条交易记录，应为0", len(hashes))
+	}
+	if hashes := ledgerTxHashes(t, bc, minerAddr); len(hashes) != 1 {
+		t.Fatalf("矿工有%d条交易记录，应为1", len(hashes))
+	}
+	tx := newTestTransaction(t, bc, miner, map[string]float64{bobAddr: 3}, TxOptions{})
+	if err := bc.AddBlock(minerAddr, []*transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+	mainTip := bc.Iterator().Next()
+	ledger := WalletLedger{bc}
+	entries, err := ledger.ListTransactions(bobAddr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !bytes.Equal(entries[0].TxHash, tx.TxHash) || entries[0].Category != ledgerReceive || entries[0].Amount != 3 {
+		t.Fatalf("bob的交易记录错误：%+v", entries)
+	}
+	//矿工的记录：第一个区块的奖励、转账、区块奖励，从新到旧排列
+	minerEntries, err := ledger.ListTransactions(minerAddr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(minerEntries) != 3 || minerEntries[2].Height != 1 || minerEntries[2].Category != ledgerGenerate {
+		t.Fatalf("矿工的交易记录错误：%+v", minerEntries)
+	}
+
+	//高度较低的分叉上的区块只保存，不连接
+	side := NewBlock(2, first.Hash, []*transaction{newCoinbaseTransactionWithFees(bobAddr, 2, 0)})
+	if err := bc.AddBlockToBlockchain(side); err != nil {
+		t.Fatal(err)
+	}
+	if hashes := ledgerTxHashes(t, bc, bobAddr); len(hashes) != 1 {
+		t.Fatalf("分叉上的区块写入了账本，bob有%d条交易记录", len(hashes))
+	}
+
+	//分叉变得更长后切换过去，原来的转账被断开，分叉上的奖励被连接
+	side2 := NewBlock(3, side.Hash, []*transaction{newCoinbaseTransactionWithFees(bobAddr, 3, 0)})
+	if err := bc.AddBlockToBlockchain(side2); err != nil {
+		t.Fatal(err)
+	}
+	hashes := ledgerTxHashes(t, bc, bobAddr)
+	if len(hashes) != 2 || !bytes.Equal(hashes[0], side2.Txs[0].TxHash) || !bytes.Equal(hashes[1], side.Txs[0].TxHash) {
+		t.Fatalf("切换分叉后bob的交易记录错误：%x", hashes)
+	}
+	if hashes := ledgerTxHashes(t, bc, minerAddr); len(hashes) != 1 {
+		t.Fatalf("切换分叉后矿工有%d条交易记录，应为1", len(hashes))
+	}
+
+	//切换回原来的分叉
+	mineTestBlocks(t, bc, miner, 0)
+	setTestTip(t, bc, mainTip)
+	hashes = ledgerTxHashes(t, bc, bobAddr)
+	if len(hashes) != 1 || !bytes.Equal(hashes[0], tx.TxHash) {
+		t.Fatalf("切换回原来的分叉后bob的交易记录错误：%x", hashes)
+	}
+}
+
+//reindex清空账本，查询时重新扫描
+func TestWalletLedgerRescanAfterReindex(t *testing.T) {
+	miner := newTestWallet(t, 1, KeyTypeP256)
+	minerAddr := string(miner.GetAddress())
+	bc := newTestChain(t, miner)
+	mineTestBlocks(t, bc, miner, 2)
+	before := ledgerTxHashes(t, bc, minerAddr)
+	if err := bc.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	after := ledgerTxHashes(t, bc, minerAddr)
+	if len(before) != 3 || len(after) != 3 {
+		t.Fatalf("reindex前后矿工有%d和%d条交易记录，应为3", len(before), len(after))
+	}
+	for i := range before {
+		if !bytes.Equal(before[i], after[i]) {
+			t.Fatalf("reindex后第%d条交易记录不一致", i)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package blc
+
+import (
+	"bytes"
+	"testing"
+)
+
+//旧版本的钱包文件迁移时公钥补齐为64字节，地址保持不变，地址中的输出仍然可以花费
+func TestLegacyWalletMigration(t *testing.T) {
+	resetTestConfig(t)
+	dataDir := t.TempDir()
+	cfg.DataDir = dataDir
+	nodeId := "legacy"
+	key := legacyTestKey(t)
+	legacyPubKey := append(key.X.Bytes(), key.Y.Bytes()...)
+	address := string(encodeAddress(activeNetParams.PubKeyHashAddrID, HashPubKey(legacyPubKey)))
+	//旧版本的钱包文件中直接存储了椭圆曲线，当前的Go版本无法编码，这里直接迁移其中的钱包
+	wf := &walletFile{Wallets: map[string]*Wallet{address: legacyP256Wallet(key, legacyPubKey)}}
+	wallet := wf.Wallets[address]
+	if wallet == nil || len(wallet.PublicKey) != publicKeyLen || !bytes.Equal(wallet.LegacyPublicKey, legacyPubKey) {
+		t.Fatalf("迁移后的钱包错误：%+v", wallet)
+	}
+	if string(wallet.GetAddress()) != address {
+		t.Fatalf("迁移后地址变为%s", wallet.GetAddress())
+	}
+	//以新格式保存后再读取
+	if err := wf.save(nodeId); err != nil {
+		t.Fatal(err)
+	}
+	wallets, err := getAllWallets(nodeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet = wallets[address]; wallet == nil || string(wallet.GetAddress()) != address || len(wallet.PublicKey) != publicKeyLen {
+		t.Fatal("以新格式保存后钱包不一致")
+	}
+
+	bc := newTestChain(t, wallet)
+	cfg.DataDir = dataDir
+	to := string(newTestWallet(t, 2, KeyTypeP256).GetAddress())
+	tx := newTestTransaction(t, bc, wallet, map[string]float64{to: 1}, TxOptions{})
+	if err := bc.AddBlock(address, []*transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := SignMessage(nodeId, address, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyMessage(address, signature, "hello"); err != nil {
+		t.Fatal(err)
+	}
+}
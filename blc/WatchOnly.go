@@ -0,0 +1,109 @@
+package blc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+//只读地址：钱包中只保存地址（和公钥），不保存私钥，可以查看余额并创建部分签名交易，
+//部分签名交易由保存私钥的离线钱包签名后再广播
+
+//只读地址的信息
+type watchOnlyAddress struct {
+	//公钥，只添加地址时为空
+	PublicKey []byte
+	//由扩展公钥派生时，为扩展公钥及在扩展公钥下的派生路径
+	Xpub string
+	Path string
+}
+
+//添加只读地址，pubKey可以为空，不为空时必须与地址匹配
+func AddWatchOnlyAddress(nodeId, address string, pubKey []byte) error {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	address = addr.String()
+	if pubKey != nil {
+		pubKeyHash, _, err := pubKeyHashFromAddress(address)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(HashPubKey(pubKey), pubKeyHash) {
+			return errors.New("公钥与地址" + address + "不匹配")
+		}
+	}
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return err
+	}
+	err = wf.addWatchOnly(address, &watchOnlyAddress{PublicKey: pubKey})
+	if err != nil {
+		return err
+	}
+	return wf.save(nodeId)
+}
+
+//添加扩展公钥，由扩展公钥派生地址，直到连续hdGapLimit个地址都没有被使用过，返回添加的地址
+func AddWatchOnlyXpub(nodeId, xpub string, isUsed func(pubKeyHash []byte) bool) ([]string, error) {
+	accountKey, err := ParseExtendedKey(xpub)
+	if err != nil {
+		return nil, err
+	}
+	if accountKey.IsPrivate {
+		return nil, errors.New("只能添加扩展公钥，请勿将扩展私钥保存到只读钱包中")
+	}
+	chainKey, err := accountKey.Child(0)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := loadWalletFile(nodeId)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	unused := 0
+	for index := uint32(0); unused < hdGapLimit; index++ {
+		key, err := chainKey.Child(index)
+		if err != nil {
+			continue
+		}
+		pubKey := key.publicKey()
+		if isUsed(HashPubKey(pubKey)) {
+			unused = 0
+		} else {
+			unused++
+		}
+		address := string(encodeAddress(activeNetParams.PubKeyHashAddrID, HashPubKey(pubKey)))
+		if _, ok := wf.WatchOnly[address]; ok {
+			continue
+		}
+		err = wf.addWatchOnly(address, &watchOnlyAddress{PublicKey: pubKey, Xpub: xpub, Path: fmt.Sprintf("0/%d", index)})
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, wf.save(nodeId)
+}
+
+//将只读地址加入钱包，钱包中已有该地址的私钥时返回错误
+func (wf *walletFile) addWatchOnly(address string, watch *watchOnlyAddress) error {
+	if _, ok := wf.Wallets[address]; ok {
+		return errors.New("钱包中已经有地址" + address + "的私钥")
+	}
+	if _, ok := wf.WatchOnly[address]; ok {
+		return errors.New("钱包中已经存在只读地址" + address)
+	}
+	wf.WatchOnly[address] = watch
+	return nil
+}
+
+//创建从只读地址转出的部分签名交易，只支持公钥哈希地址，交易中的公钥在签名时由签名者补充
+func NewWatchOnlyTransaction(from string, tos map[string]float64, opts TxOptions, bc *blockChain) (*PartialTx, error) {
+	if _, _, err := pubKeyHashFromAddress(from); err != nil {
+		return nil, err
+	}
+	return NewPartialTx(from, nil, tos, opts, bc)
+}
@@ -0,0 +1,16 @@
+module study-public-chain
+
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.2.0
+	github.com/boltdb/bolt v1.3.1
+	github.com/btcsuite/btcd/btcec/v2 v2.3.2
+	golang.org/x/crypto v0.9.0
+)
+
+require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+)